@@ -21,6 +21,7 @@ import (
 
 	ds "github.com/goldfiglabs/rpcheckup/pkg/dockersession"
 	"github.com/goldfiglabs/rpcheckup/pkg/introspector"
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
 	ps "github.com/goldfiglabs/rpcheckup/pkg/postgres"
 	"github.com/goldfiglabs/rpcheckup/pkg/report"
 )
@@ -58,9 +59,9 @@ func loadAwsCredentials(ctx context.Context) ([]string, error) {
 
 func printReportRows(rows []report.Row) {
 	for _, r := range rows {
-		fmt.Printf("Arn %v Service %v Resource %v Is Public %v External Accounts [%v] In-Org Accounts [%v]\n",
-			r.Arn, r.Service, r.ProviderType, r.IsPublic, strings.Join(r.ExternalAccounts, ","),
-			strings.Join(r.InOrgAccounts, ", "))
+		fmt.Printf("Arn %v Service %v Resource %v Is Public %v External Accounts [%v] In-Org Accounts [%v] Narrowed By Deny %v\n",
+			r.Arn, r.Service, r.ProviderType, r.IsPublic(), strings.Join(r.ExternalAccounts, ","),
+			strings.Join(r.InOrgAccounts, ", "), r.NarrowedByDeny)
 	}
 }
 
@@ -69,10 +70,59 @@ type templateData struct {
 }
 
 var accessColors = map[string]string{
-	"Public":            "red",
-	"External Accounts": "orange",
-	"In-Org Accounts":   "yellow",
-	"Private":           "green",
+	"Public":               "red",
+	"Conditionally Public": "pink",
+	"Network-Restricted":   "salmon",
+	"External Accounts":    "orange",
+	"In-Org Accounts":      "yellow",
+	"AWS Services":         "blue",
+	"Private":              "green",
+}
+
+func findingsSummary(findings []report.Finding) string {
+	descriptions := make([]string, len(findings))
+	for i, f := range findings {
+		descriptions[i] = f.Description
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+func grantsSummary(grants []report.Grant) string {
+	summaries := make([]string, len(grants))
+	for i, g := range grants {
+		principal := g.Principal
+		if g.Window != "" {
+			principal += " (" + string(g.Window) + ")"
+		}
+		summaries[i] = principal + ": " + strings.Join(g.Actions, ", ")
+		if len(g.Constraints) > 0 {
+			summaries[i] += " [" + strings.Join(g.Constraints, ", ") + "]"
+		}
+	}
+	return strings.Join(summaries, "; ")
+}
+
+func accessControlsSummary(controls []report.AccessControl) string {
+	summaries := make([]string, len(controls))
+	for i, c := range controls {
+		summaries[i] = c.Mechanism + ": " + c.Description
+	}
+	return strings.Join(summaries, "; ")
+}
+
+func functionURLSummary(functionURL *report.FunctionURL) string {
+	if functionURL == nil {
+		return ""
+	}
+	return functionURL.URL + " (AuthType " + functionURL.AuthType + ", CORS " + functionURL.CORS() + ")"
+}
+
+func evidenceSummary(evidence []policy.Evidence) string {
+	references := make([]string, len(evidence))
+	for i, e := range evidence {
+		references[i] = e.Reference()
+	}
+	return strings.Join(references, "; ")
 }
 
 func writeCSVReport(rpReport *report.Report, outputFilename string) error {
@@ -83,7 +133,7 @@ func writeCSVReport(rpReport *report.Report, outputFilename string) error {
 	defer outputFile.Close()
 	writer := csv.NewWriter(outputFile)
 	defer writer.Flush()
-	writer.Write([]string{"ARN", "Service", "Resource", "Access Allows", "In-Org Accounts", "External Accounts", "Is Public"})
+	writer.Write([]string{"ARN", "Service", "Resource", "Access Allows", "In-Org Accounts", "External Accounts", "AWS Services", "Network Restrictions", "Access Levels", "Actions", "Statements", "Is Public", "Unevaluated Condition Keys", "Narrowed By Deny", "Findings", "Orphaned Principals", "Organizational Units", "Access Controls", "Linked Resources", "Function URL"})
 	for _, row := range rpReport.Rows {
 		writer.Write([]string{
 			row.Arn,
@@ -92,7 +142,20 @@ func writeCSVReport(rpReport *report.Report, outputFilename string) error {
 			row.Access(),
 			strings.Join(row.InOrgAccounts, ", "),
 			strings.Join(row.ExternalAccounts, ", "),
-			strconv.FormatBool(row.IsPublic),
+			strings.Join(row.Services, ", "),
+			strings.Join(row.NetworkRestrictions, ", "),
+			strings.Join(row.AccessLevels, ", "),
+			grantsSummary(row.Grants),
+			evidenceSummary(row.Evidence),
+			strconv.FormatBool(row.IsPublic()),
+			strings.Join(row.UnevaluatedConditionKeys, ", "),
+			strconv.FormatBool(row.NarrowedByDeny),
+			findingsSummary(row.Findings),
+			strings.Join(row.OrphanedPrincipals, ", "),
+			strings.Join(row.OrganizationalUnits, ", "),
+			accessControlsSummary(row.AccessControls),
+			strings.Join(row.LinkedResources, ", "),
+			functionURLSummary(row.FunctionURL),
 		})
 	}
 	return nil
@@ -157,18 +220,24 @@ type resourceSpecMap = map[string][]string
 var supportedResources resourceSpecMap = map[string][]string{
 	"acm-pca":        {"CertificateAuthority"},
 	"iam":            {"role"},
+	"backup":         {"BackupVault"},
 	"glacier":        {"Vault"},
 	"efs":            {"FileSystem"},
 	"organizations":  nil,
+	"ram":            {"ResourceShare"},
 	"kms":            {"Key"},
 	"apigateway":     {"RestApi"},
 	"ecr":            {"Repository"},
 	"es":             {"Domain"},
+	"events":         {"EventBus"},
 	"ec2":            {"Images", "Snapshots"},
 	"lambda":         {"Alias", "Function", "LayerVersion"},
 	"logs":           {"LogGroup", "ResourcePolicies"},
 	"rds":            {"DBSnapshot", "DBClusterSnapshot"},
+	"redshift":       {"Snapshot"},
 	"s3":             {"Bucket"},
+	"s3control":      {"AccessPoint", "AccountPublicAccessBlock", "MultiRegionAccessPoint"},
+	"schemas":        {"Registry"},
 	"secretsmanager": {"Secret"},
 	"ses":            {"Identity"},
 	"sns":            {"Topic"},
@@ -190,6 +259,7 @@ func serviceSpec(r resourceSpecMap) string {
 func main() {
 	pkger.Include("/templates")
 	pkger.Include("/queries")
+	pkger.Include("/catalog")
 	var skipIntrospector, leavePostgresUp, reusePostgres, logIntrospector, printToStdOut, skipIntrospectorPull bool
 	var outputDir, introspectorRef string
 	flag.BoolVar(&skipIntrospector, "skip-introspector", false, "Skip running an import, use existing data")
@@ -0,0 +1,59 @@
+package policy
+
+import (
+	"regexp"
+	"strings"
+)
+
+// matchesPattern returns true if the value matches a policy pattern, in which
+// * matches any characters and ? matches any single character
+func matchesPattern(pattern string, value string) bool {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("^" + quoted + "$").MatchString(value)
+}
+
+// coversAction returns true if the Action or NotAction patterns cover the
+// action, which is matched case-insensitively
+func coversAction(actions []string, notActions []string, action string) bool {
+	action = strings.ToLower(action)
+	matchesAny := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if matchesPattern(strings.ToLower(pattern), action) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(notActions) > 0 {
+		return !matchesAny(notActions)
+	}
+	return matchesAny(actions)
+}
+
+// allowsAction returns true if the statement's Action or NotAction covers the
+// action
+func (s *Statement) allowsAction(action string) bool {
+	return coversAction(s.Action, s.NotAction, action)
+}
+
+// Allows returns true if the grant includes the action
+func (g Grant) Allows(action string) bool {
+	return coversAction(g.Actions, g.NotActions, action)
+}
+
+// DenyingToAll returns the indexes of the Deny statements that apply to every
+// principal and cover the action. Conditions are not considered, as
+// protective Deny statements usually exempt a break-glass role.
+func (p *Policy) DenyingToAll(action string) []int {
+	indexes := []int{}
+	for i := range p.Statement {
+		s := &p.Statement[i]
+		if s.Effect == EffectDeny && s.Principal != nil && contains(s.Principal.accountIDs(), Wildcard) &&
+			s.allowsAction(action) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,415 @@
+package policy
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Conditions is a Condition element, mapping condition operators, such as
+// StringEquals, to condition keys and their values
+type Conditions map[string]map[string]Values
+
+// Set operators for multivalued condition keys
+const (
+	ForAllValues = "forallvalues"
+	ForAnyValue  = "foranyvalue"
+)
+
+// ConditionEntry is a single operator, key and values of a Condition element
+type ConditionEntry struct {
+	// Operator is the base operator, such as stringequals, without its set
+	// operator prefix or IfExists suffix
+	Operator string
+	// SetOperator is ForAllValues or ForAnyValue, or "" if none is used
+	SetOperator string
+	// IfExists is set when the operator has the IfExists suffix
+	IfExists bool
+	Key      string
+	Values   Values
+}
+
+// Entries flattens the conditions. Operators and keys are lowercased, as
+// they are matched case-insensitively.
+func (c Conditions) Entries() []ConditionEntry {
+	entries := []ConditionEntry{}
+	for operator, keys := range c {
+		base := strings.ToLower(operator)
+		setOperator := ""
+		if parts := strings.SplitN(base, ":", 2); len(parts) == 2 {
+			setOperator = parts[0]
+			base = parts[1]
+		}
+		ifExists := strings.HasSuffix(base, "ifexists")
+		base = strings.TrimSuffix(base, "ifexists")
+		for key, values := range keys {
+			entries = append(entries, ConditionEntry{
+				Operator:    base,
+				SetOperator: setOperator,
+				IfExists:    ifExists,
+				Key:         strings.ToLower(key),
+				Values:      values,
+			})
+		}
+	}
+	return entries
+}
+
+// restricts returns true if the entry only matches requests that include its
+// condition key. IfExists matches requests without the key, as does
+// ForAllValues, since every one of no values matches. Requests from
+// anonymous principals, principals outside any organization, or made
+// directly rather than through a service all lack some of the keys used to
+// restrict access, so such entries do not restrict who has access.
+func (e ConditionEntry) restricts() bool {
+	return !e.IfExists && e.SetOperator != ForAllValues
+}
+
+// positiveOperators restrict access to requests matching their values. The
+// negated variants allow everything but their values, and so never restrict
+// access to a set of accounts.
+var positiveOperators = map[string]bool{
+	"stringequals":           true,
+	"stringequalsignorecase": true,
+	"stringlike":             true,
+	"arnequals":              true,
+	"arnlike":                true,
+}
+
+var accountConditionKeys = map[string]bool{
+	"kms:calleraccount":    true,
+	"aws:sourceowner":      true,
+	"aws:principalaccount": true,
+	"aws:principalarn":     true,
+	"aws:sourceaccount":    true,
+	"aws:sourcearn":        true,
+	// a bucket policy delegates access control to the access points of the
+	// accounts these keys name
+	"s3:dataaccesspointaccount": true,
+	"s3:dataaccesspointarn":     true,
+}
+
+var accessPointConditionKeys = map[string]bool{
+	"s3:dataaccesspointaccount": true,
+	"s3:dataaccesspointarn":     true,
+}
+
+var orgConditionKeys = map[string]bool{
+	"aws:principalorgid":    true,
+	"aws:principalorgpaths": true,
+	"aws:sourceorgid":       true,
+}
+
+var sourceConditionKeys = map[string]bool{
+	"aws:sourceaccount": true,
+	"aws:sourcearn":     true,
+	"aws:sourceorgid":   true,
+	"aws:sourceowner":   true,
+}
+
+var networkConditionKeys = map[string]bool{
+	"aws:sourceip":    true,
+	"aws:vpcsourceip": true,
+	"aws:sourcevpc":   true,
+	"aws:sourcevpce":  true,
+}
+
+// spoofableConditionKeys are set from values the caller controls, so they
+// never restrict who can access a resource
+var spoofableConditionKeys = map[string]bool{
+	"aws:referer":         true,
+	"aws:useragent":       true,
+	"aws:securetransport": true,
+}
+
+// resourceConditionKeys describe the resource being accessed, which for a
+// resource policy is the resource itself, so they are met by any caller
+var resourceConditionKeys = map[string]bool{
+	"aws:resourceaccount":  true,
+	"aws:resourceorgid":    true,
+	"aws:resourceorgpaths": true,
+}
+
+// invocationConditionKeys restrict how a resource is accessed, rather than
+// who can access it
+var invocationConditionKeys = map[string]bool{
+	"lambda:functionurlauthtype": true,
+}
+
+var arnWithAccountPattern = regexp.MustCompile(`^arn:[^:]*:[^:]*:[^:]*:[0-9]{12}(:|$)`)
+var orgIDPattern = regexp.MustCompile(`^o-[a-z0-9]{10,32}$`)
+
+// IsOrgID returns true if the identifier is an organization id rather than
+// an account id
+func IsOrgID(identifier string) bool {
+	return orgIDPattern.MatchString(identifier)
+}
+
+// conditionValueAccountID returns the account id a value of an account
+// condition key refers to, or Wildcard if it can match any account. Values
+// using wildcards in the account field, or ARNs without an account field,
+// match any account.
+func conditionValueAccountID(key string, value string) string {
+	if key == "aws:principalarn" || key == "aws:sourcearn" || key == "s3:dataaccesspointarn" {
+		if arnWithAccountPattern.MatchString(value) {
+			return arnAccountID(value)
+		}
+		return Wildcard
+	}
+	if accountIDPattern.MatchString(value) {
+		return value
+	}
+	return Wildcard
+}
+
+// conditionValueOrgID returns the organization id a value of an organization
+// condition key refers to, or Wildcard if it can match any organization.
+// aws:PrincipalOrgPaths values start with the organization id, e.g.
+// o-a1b2c3d4e5/r-ab12/ou-ab12-11111111/*
+func conditionValueOrgID(key string, value string) string {
+	if key == "aws:principalorgpaths" {
+		value = strings.SplitN(value, "/", 2)[0]
+	}
+	if IsOrgID(value) {
+		return value
+	}
+	return Wildcard
+}
+
+// allowedIdentifiers returns the accounts the conditions restrict access to,
+// the organizations they restrict access to, or Wildcard if they do not
+// restrict who has access. Each condition key must be satisfied, so when
+// several keys restrict access only the values matched by all of them are
+// returned. Account keys are more specific than organization keys, so
+// organizations are only returned when no account key restricts access.
+func (c Conditions) allowedIdentifiers() []string {
+	type keyValues struct {
+		isOrg      bool
+		values     map[string]bool
+		isWildcard bool
+	}
+	byKey := map[string]*keyValues{}
+	for _, entry := range c.Entries() {
+		if !positiveOperators[entry.Operator] || !entry.restricts() {
+			continue
+		}
+		isOrg := orgConditionKeys[entry.Key]
+		if !isOrg && !accountConditionKeys[entry.Key] {
+			continue
+		}
+		kv, ok := byKey[entry.Key]
+		if !ok {
+			kv = &keyValues{isOrg: isOrg, values: map[string]bool{}}
+			byKey[entry.Key] = kv
+		}
+		for _, value := range entry.Values {
+			var id string
+			if isOrg {
+				id = conditionValueOrgID(entry.Key, value)
+			} else {
+				id = conditionValueAccountID(entry.Key, value)
+			}
+			if id == Wildcard {
+				kv.isWildcard = true
+			}
+			kv.values[id] = true
+		}
+	}
+	restrictive := []*keyValues{}
+	hasAccountKey := false
+	for _, kv := range byKey {
+		if !kv.isWildcard {
+			restrictive = append(restrictive, kv)
+			hasAccountKey = hasAccountKey || !kv.isOrg
+		}
+	}
+	if len(restrictive) == 0 {
+		return []string{Wildcard}
+	}
+	var allowed map[string]bool
+	for _, kv := range restrictive {
+		if kv.isOrg && hasAccountKey {
+			continue
+		}
+		if allowed == nil {
+			allowed = kv.values
+			continue
+		}
+		intersection := map[string]bool{}
+		for id := range allowed {
+			if kv.values[id] {
+				intersection[id] = true
+			}
+		}
+		allowed = intersection
+	}
+	return sortedKeys(allowed)
+}
+
+// unevaluatedKeys returns the condition keys that could restrict who has
+// access, but that are not evaluated, as written in the policy. Date
+// conditions restrict when, rather than who, and are evaluated separately.
+func (c Conditions) unevaluatedKeys() []string {
+	keys := map[string]bool{}
+	for _, byKey := range c {
+		for key := range byKey {
+			lower := strings.ToLower(key)
+			if !accountConditionKeys[lower] && !orgConditionKeys[lower] &&
+				!networkConditionKeys[lower] && !spoofableConditionKeys[lower] &&
+				!timeConditionKeys[lower] && !invocationConditionKeys[lower] && !resourceConditionKeys[lower] {
+				keys[key] = true
+			}
+		}
+	}
+	return sortedKeys(keys)
+}
+
+// hasSourceCondition returns true if a condition ties a service's access to
+// the account, organization, or resource on whose behalf the service acts
+func (c Conditions) hasSourceCondition() bool {
+	for _, entry := range c.Entries() {
+		if sourceConditionKeys[entry.Key] && entry.restricts() {
+			return true
+		}
+	}
+	return false
+}
+
+// accessPointAccounts returns the accounts whose S3 access points the
+// conditions delegate access control to, or Wildcard for any account
+func (c Conditions) accessPointAccounts() []string {
+	accounts := map[string]bool{}
+	for _, entry := range c.Entries() {
+		if !accessPointConditionKeys[entry.Key] || !positiveOperators[entry.Operator] || !entry.restricts() {
+			continue
+		}
+		for _, value := range entry.Values {
+			accounts[conditionValueAccountID(entry.Key, value)] = true
+		}
+	}
+	return sortedKeys(accounts)
+}
+
+// hasConfusedDeputyProtection returns true if the conditions require an
+// sts:ExternalId, which a third party sets to the customer it acts for, or
+// MFA, which a third party's automation cannot provide
+func (c Conditions) hasConfusedDeputyProtection() bool {
+	for _, entry := range c.Entries() {
+		if !entry.restricts() {
+			continue
+		}
+		switch {
+		case entry.Key == "sts:externalid" && positiveOperators[entry.Operator]:
+			for _, value := range entry.Values {
+				if entry.Operator != "stringlike" || strings.Trim(value, "*?") != "" {
+					return true
+				}
+			}
+		case entry.Key == "aws:multifactorauthpresent" && entry.Operator == "bool":
+			if contains(entry.Values, "true") {
+				return true
+			}
+		case entry.Key == "aws:multifactorauthage" && strings.HasPrefix(entry.Operator, "numericlessthan"):
+			return true
+		}
+	}
+	return false
+}
+
+// hasIneffectiveRestriction returns true if a condition that would restrict
+// who has access is made ineffective by IfExists or ForAllValues
+func (c Conditions) hasIneffectiveRestriction() bool {
+	for _, entry := range c.Entries() {
+		isRestrictingKey := accountConditionKeys[entry.Key] || orgConditionKeys[entry.Key] ||
+			networkConditionKeys[entry.Key]
+		isRestrictingOperator := positiveOperators[entry.Operator] || entry.Operator == "ipaddress"
+		if isRestrictingKey && isRestrictingOperator && !entry.restricts() {
+			return true
+		}
+	}
+	return false
+}
+
+// networkRestriction is a CIDR, VPC or VPC endpoint a condition restricts
+// access to. Broad restrictions do not meaningfully restrict anything.
+type networkRestriction struct {
+	key         string
+	restriction string
+	broad       bool
+}
+
+// isBroadNetworkRestriction returns true for wildcard VPC or VPC endpoint
+// ids, unparseable addresses, and CIDRs larger than a /8 (IPv4) or /32
+// (IPv6), such as 0.0.0.0/0
+func isBroadNetworkRestriction(key string, value string) bool {
+	if key != "aws:sourceip" && key != "aws:vpcsourceip" {
+		return strings.ContainsAny(value, "*?")
+	}
+	if !strings.Contains(value, "/") {
+		return net.ParseIP(value) == nil
+	}
+	ip, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return true
+	}
+	ones, _ := network.Mask.Size()
+	if ip.To4() != nil {
+		return ones < 8
+	}
+	return ones < 32
+}
+
+// networkRestrictions returns the CIDRs, VPCs and VPC endpoints the
+// conditions restrict network access to. Negated operators such as
+// NotIpAddress allow every network but the listed ones, and so restrict
+// nothing.
+func (c Conditions) networkRestrictions() []networkRestriction {
+	restrictions := []networkRestriction{}
+	for _, entry := range c.Entries() {
+		if !entry.restricts() {
+			continue
+		}
+		isIP := entry.Key == "aws:sourceip" || entry.Key == "aws:vpcsourceip"
+		isVpc := entry.Key == "aws:sourcevpc" || entry.Key == "aws:sourcevpce"
+		if !(isIP && entry.Operator == "ipaddress") &&
+			!(isVpc && (entry.Operator == "stringequals" || entry.Operator == "stringequalsignorecase" || entry.Operator == "stringlike")) {
+			continue
+		}
+		for _, value := range entry.Values {
+			restrictions = append(restrictions, networkRestriction{
+				key:         entry.Key,
+				restriction: value,
+				broad:       isBroadNetworkRestriction(entry.Key, value),
+			})
+		}
+	}
+	return restrictions
+}
+
+// effectiveNetworkRestrictions returns the network restrictions that actually
+// limit access: those of every condition key whose values are all narrow
+func (c Conditions) effectiveNetworkRestrictions() []string {
+	restrictions := c.networkRestrictions()
+	broadKeys := map[string]bool{}
+	for _, r := range restrictions {
+		if r.broad {
+			broadKeys[r.key] = true
+		}
+	}
+	effective := map[string]bool{}
+	for _, r := range restrictions {
+		if !broadKeys[r.key] {
+			effective[r.restriction] = true
+		}
+	}
+	return sortedKeys(effective)
+}
+
+func (c Conditions) hasBroadNetworkRestriction() bool {
+	for _, r := range c.networkRestrictions() {
+		if r.broad {
+			return true
+		}
+	}
+	return false
+}
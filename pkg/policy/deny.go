@@ -0,0 +1,175 @@
+package policy
+
+import (
+	"strings"
+)
+
+// Scopes of a denyRule
+const (
+	// access for the listed accounts (Wildcard for all) is removed
+	denyPrincipals = "principals"
+	// access for anyone but the listed accounts is removed
+	denyOutsideAccounts = "outside_accounts"
+	// access for anyone outside the listed organizations is removed
+	denyOutsideOrg = "outside_org"
+)
+
+// denyRule is the restriction a Deny statement imposes on access granted
+// elsewhere in the policy
+type denyRule struct {
+	scope  string
+	values []string
+	// index is the position of the Deny statement in the policy
+	index int
+	// resources are the Deny statement's resources, empty when it names
+	// none
+	resources []string
+}
+
+// coversAllActions returns true if the statement's actions include a
+// wildcard covering a whole service, so that a Deny removes access
+// regardless of what was allowed
+func (s *Statement) coversAllActions() bool {
+	for _, action := range s.Action {
+		if action == "*" || strings.HasSuffix(action, ":*") {
+			return true
+		}
+	}
+	return false
+}
+
+// denyRule returns the rule a Deny statement imposes, or nil if it imposes
+// none we can reason about. A Deny with NotPrincipal applies to everyone but
+// the listed principals, so it becomes an outside_accounts rule. Deny with
+// NotAction never covers every action, so it is not considered, and neither
+// is Deny with NotResource, as it leaves the listed resources accessible. Deny
+// statements with conditions we cannot reason about produce no rule, as we
+// cannot be sure they apply. IfExists and set operators only make a Deny
+// apply to more requests, so the rule still holds when they are used.
+func (s *Statement) denyRule() *denyRule {
+	if s.Effect != EffectDeny || !s.coversAllActions() || len(s.NotResource) > 0 {
+		return nil
+	}
+	rule := s.buildDenyRule(s.Condition.Entries())
+	if rule == nil {
+		return nil
+	}
+	if rule.scope != denyPrincipals && contains(rule.values, Wildcard) {
+		// a wildcard exemption exempts everyone, so the Deny never applies
+		return nil
+	}
+	rule.resources = s.Resource
+	return rule
+}
+
+func (s *Statement) buildDenyRule(entries []ConditionEntry) *denyRule {
+	if len(entries) == 0 {
+		if s.NotPrincipal != nil {
+			return &denyRule{scope: denyOutsideAccounts, values: s.NotPrincipal.accountIDs()}
+		}
+		if s.Principal == nil {
+			return nil
+		}
+		// denying an individual user or role leaves the rest of its account's
+		// access in place, so only account-wide principals are considered
+		ids := s.Principal.accountLevelIDs()
+		if len(ids) == 0 {
+			return nil
+		}
+		return &denyRule{scope: denyPrincipals, values: ids}
+	}
+	if len(entries) != 1 || s.Principal == nil || !contains(s.Principal.accountIDs(), Wildcard) {
+		return nil
+	}
+	entry := entries[0]
+	values := make([]string, len(entry.Values))
+	for i, value := range entry.Values {
+		if entry.Key == "aws:principalorgid" || entry.Key == "aws:principalorgpaths" {
+			values[i] = conditionValueOrgID(entry.Key, value)
+		} else {
+			values[i] = conditionValueAccountID(entry.Key, value)
+		}
+	}
+	isOneOf := func(operators ...string) bool {
+		for _, operator := range operators {
+			if entry.Operator == operator {
+				return true
+			}
+		}
+		return false
+	}
+	var scope string
+	switch {
+	case entry.Key == "aws:principalaccount" && isOneOf("stringequals", "stringequalsignorecase", "stringlike"):
+		scope = denyPrincipals
+	case entry.Key == "aws:principalaccount" && isOneOf("stringnotequals", "stringnotequalsignorecase", "stringnotlike"):
+		scope = denyOutsideAccounts
+	case entry.Key == "aws:principalarn" && isOneOf("stringnotlike", "arnnotequals", "arnnotlike"):
+		scope = denyOutsideAccounts
+	case (entry.Key == "aws:principalorgid" || entry.Key == "aws:principalorgpaths") &&
+		isOneOf("stringnotequals", "stringnotequalsignorecase", "stringnotlike"):
+		scope = denyOutsideOrg
+	default:
+		return nil
+	}
+	return &denyRule{scope: scope, values: values}
+}
+
+// coversResources returns true if the Deny covers every resource an Allow
+// statement grants access to. A Deny on part of a bucket, for instance,
+// leaves access to the rest of it. Statements without resources, such as
+// role trust policies, apply to the whole resource.
+func (r *denyRule) coversResources(allow *Statement) bool {
+	if len(r.resources) == 0 || contains(r.resources, Wildcard) {
+		return true
+	}
+	if len(allow.Resource) == 0 || len(allow.NotResource) > 0 {
+		return false
+	}
+	for _, resource := range allow.Resource {
+		covered := false
+		for _, pattern := range r.resources {
+			// the Allow's own wildcards are matched literally, so the Deny's
+			// pattern must be at least as broad
+			if matchesPattern(pattern, resource) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// applies returns true if the rule removes access granted to an account id,
+// organization id, or Wildcard by an Allow statement. A wildcard grant is
+// always removed by an outside_* rule; the exempted accounts or
+// organizations take its place.
+func (r *denyRule) applies(id string, allow *Statement, ctx *Context) bool {
+	if !r.coversResources(allow) {
+		return false
+	}
+	switch {
+	case r.scope == denyPrincipals:
+		return contains(r.values, Wildcard) || contains(r.values, id)
+	case id == Wildcard:
+		return true
+	case r.scope == denyOutsideAccounts:
+		return !contains(r.values, id)
+	case r.scope == denyOutsideOrg:
+		return !(contains(r.values, id) || (contains(r.values, ctx.Organization) && ctx.OrgAccounts[id]))
+	default:
+		return false
+	}
+}
+
+// narrows returns the identifiers that replace a wildcard grant removed by
+// this rule
+func (r *denyRule) narrows() []string {
+	if r.scope == denyPrincipals {
+		return nil
+	}
+	return r.values
+}
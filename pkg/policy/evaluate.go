@@ -0,0 +1,392 @@
+package policy
+
+import (
+	"sort"
+	"time"
+)
+
+// Kinds of findings reported for risky constructs in a policy
+const (
+	// Allow with NotPrincipal grants access to everyone not listed,
+	// including anonymous users
+	FindingAllowNotPrincipal = "allow-not-principal"
+	// Allow with NotAction grants every action not listed, including
+	// actions added to the service in the future
+	FindingAllowNotAction = "allow-not-action"
+	// a service principal is granted access without a source condition, so
+	// the service can be used on behalf of any account
+	FindingServiceConfusedDeputy = "service-confused-deputy"
+	// a network condition uses a wildcard or a CIDR so large that it does
+	// not limit access
+	FindingBroadNetworkCondition = "broad-network-condition"
+	// an IfExists or ForAllValues qualifier makes a condition that would
+	// restrict who has access match requests that lack the condition key
+	FindingIneffectiveCondition = "ineffective-condition-qualifier"
+	// an Allow's date conditions ended before the account was imported, so
+	// the statement grants nothing and can be removed
+	FindingExpiredGrant = "expired-grant"
+	// an Allow's date conditions only start after the account was imported
+	FindingFutureGrant = "future-grant"
+	// a principal is the unique id of a deleted IAM user or role
+	FindingOrphanedPrincipal = "orphaned-principal"
+	// a role trusts an OIDC identity provider without restricting the
+	// token's subject, so anyone using the provider can assume it
+	FindingUnrestrictedWebIdentity = "unrestricted-web-identity"
+	// an external account can assume a role without an sts:ExternalId or
+	// MFA condition. Only reported for role trust policies, by
+	// RoleTrustFindings.
+	FindingMissingExternalID = "assume-role-without-external-id"
+)
+
+// PublicAccess describes whether anyone can access a resource
+type PublicAccess string
+
+const (
+	NotPublic PublicAccess = "Not Public"
+	// ConditionallyPublic access is granted to anyone, subject to
+	// conditions that could not be evaluated
+	ConditionallyPublic PublicAccess = "Conditionally Public"
+	// UnconditionallyPublic access is granted to anyone
+	UnconditionallyPublic PublicAccess = "Public"
+)
+
+// Context describes the account and organization a policy is evaluated for
+type Context struct {
+	// Account is the id of the account being scanned
+	Account string
+	// Organization is the id of the scanned account's organization
+	Organization string
+	// OrgAccounts is the set of account ids in the organization
+	OrgAccounts map[string]bool
+	// Now is the time date conditions are evaluated at, usually when the
+	// account was imported
+	Now time.Time
+}
+
+// InOrg returns true if the account id, or organization id, is part of the
+// scanned organization
+func (c *Context) InOrg(id string) bool {
+	return c.OrgAccounts[id] || (id == c.Organization && IsOrgID(id))
+}
+
+// Grant lists the actions, or the actions excluded by NotAction, that a
+// single statement allows a principal
+type Grant struct {
+	Principal  string
+	Actions    []string
+	NotActions []string
+	// Window is whether the statement's date conditions are in effect
+	Window TimeWindow
+	// Statement is the index in Policy.Statement of the statement making
+	// the grant. Dropped statements are not in Policy.Statement, so use the
+	// statement's Index or Evidence to refer to it in the policy document.
+	Statement int
+}
+
+// Result describes who a policy grants access to
+type Result struct {
+	// HasAccess is set if any statement grants access to anyone, including
+	// grants that have expired or are not yet active, and deleted identities
+	HasAccess bool
+	// PublicAccess is whether anyone can access the resource without
+	// network restrictions
+	PublicAccess PublicAccess
+	// UnevaluatedConditionKeys lists the condition keys of conditionally
+	// public grants
+	UnevaluatedConditionKeys []string
+	// NetworkRestrictions lists the CIDRs, VPCs and VPC endpoints from which
+	// anyone can access the resource
+	NetworkRestrictions []string
+	InOrgAccounts       []string
+	ExternalAccounts    []string
+	// Services lists the AWS service principals granted access
+	Services []string
+	// NarrowedByDeny is set when a Deny statement removed or narrowed
+	// access granted by one of the policy's Allow statements
+	NarrowedByDeny bool
+	// Findings lists the kinds of risky constructs used by the policy
+	Findings []string
+	// AccessPointAccounts lists the accounts whose S3 access points the
+	// policy delegates access control to, or Wildcard for any account
+	AccessPointAccounts []string
+	// OrphanedPrincipals lists the unique ids of deleted IAM identities
+	// named as principals
+	OrphanedPrincipals []string
+	// Grants lists the actions allowed to each principal other than the
+	// scanned account, including expired and future grants, which do not
+	// otherwise count towards access
+	Grants []Grant
+	// Evidence lists the statements that grant, narrow, or raise a finding
+	// about access, in policy order
+	Evidence []Evidence
+	// UnparsedStatements counts statements whose principal could not be
+	// classified
+	UnparsedStatements int
+}
+
+// access is access granted by a single Allow statement to an account id,
+// organization id, or Wildcard
+type access struct {
+	id                  string
+	networkRestrictions []string
+	statement           *Statement
+	index               int
+}
+
+// serviceAccess is access granted by a single Allow statement to a service
+// principal
+type serviceAccess struct {
+	grant Grant
+	index int
+}
+
+func (s *Statement) grant(principal string, window TimeWindow, index int) Grant {
+	return Grant{principal, s.Action, s.NotAction, window, index}
+}
+
+// allowedIDs returns the account ids, organization ids or Wildcard an Allow
+// statement grants access to. A wildcard principal restricted by an
+// organization condition is recorded as the organization id. An Allow with
+// NotPrincipal grants access to everyone except the listed principals, so it
+// is treated as a grant to Wildcard, as is an OIDC trust anyone using the
+// identity provider can satisfy.
+func (s *Statement) allowedIDs() []string {
+	principals := []string{}
+	if s.Principal != nil {
+		principals = s.Principal.accountIDs()
+	}
+	if s.NotPrincipal != nil || s.isUnrestrictedWebIdentity() {
+		principals = append(principals, Wildcard)
+	}
+	conditionIDs := s.Condition.allowedIdentifiers()
+	ids := map[string]bool{}
+	for _, principal := range principals {
+		for _, conditionID := range conditionIDs {
+			switch {
+			case principal == Wildcard:
+				ids[conditionID] = true
+			case conditionID == Wildcard || conditionID == principal || IsOrgID(conditionID):
+				ids[principal] = true
+			}
+		}
+	}
+	return sortedKeys(ids)
+}
+
+func (s *Statement) findings() []string {
+	findings := []string{}
+	if s.Effect == EffectAllow && s.NotPrincipal != nil {
+		findings = append(findings, FindingAllowNotPrincipal)
+	}
+	if s.Effect == EffectAllow && len(s.NotAction) > 0 {
+		findings = append(findings, FindingAllowNotAction)
+	}
+	if s.Effect == EffectAllow && len(s.Principal.services()) > 0 && !s.Condition.hasSourceCondition() {
+		findings = append(findings, FindingServiceConfusedDeputy)
+	}
+	if s.Effect == EffectAllow && s.Condition.hasBroadNetworkRestriction() {
+		findings = append(findings, FindingBroadNetworkCondition)
+	}
+	if s.Effect == EffectAllow && s.Condition.hasIneffectiveRestriction() {
+		findings = append(findings, FindingIneffectiveCondition)
+	}
+	if s.isUnrestrictedWebIdentity() {
+		findings = append(findings, FindingUnrestrictedWebIdentity)
+	}
+	if len(s.Principal.orphaned()) > 0 || len(s.NotPrincipal.orphaned()) > 0 {
+		findings = append(findings, FindingOrphanedPrincipal)
+	}
+	return findings
+}
+
+// Evaluate determines who the policy grants access to. Deny statements are
+// only taken into account when they cover every action of a service and
+// every resource of the Allow they deny, and their principal and conditions
+// can be reasoned about.
+func Evaluate(p *Policy, ctx *Context) *Result {
+	result := &Result{PublicAccess: NotPublic}
+	accesses := []access{}
+	serviceAccesses := []serviceAccess{}
+	rules := []*denyRule{}
+	inactiveGrants := []Grant{}
+	findings := map[string]bool{}
+	orphaned := map[string]bool{}
+	accessPointAccounts := map[string]bool{}
+	evidence := map[int]bool{}
+	for i := range p.Statement {
+		statement := &p.Statement[i]
+		if statement.unparsed() {
+			result.UnparsedStatements++
+		}
+		for _, finding := range statement.findings() {
+			findings[finding] = true
+			evidence[i] = true
+		}
+		for _, id := range append(statement.Principal.orphaned(), statement.NotPrincipal.orphaned()...) {
+			orphaned[id] = true
+		}
+		window := statement.Condition.timeWindow(ctx.Now)
+		switch {
+		case statement.Effect == EffectAllow && (window == TimeExpired || window == TimeFuture):
+			if window == TimeExpired {
+				findings[FindingExpiredGrant] = true
+			} else {
+				findings[FindingFutureGrant] = true
+			}
+			evidence[i] = true
+			for _, id := range statement.allowedIDs() {
+				if id != ctx.Account {
+					inactiveGrants = append(inactiveGrants, statement.grant(id, window, i))
+				}
+			}
+			for _, service := range statement.Principal.services() {
+				inactiveGrants = append(inactiveGrants, statement.grant(service, window, i))
+			}
+		case statement.Effect == EffectAllow:
+			for _, id := range statement.Condition.accessPointAccounts() {
+				accessPointAccounts[id] = true
+			}
+			networkRestrictions := statement.Condition.effectiveNetworkRestrictions()
+			for _, id := range statement.allowedIDs() {
+				accesses = append(accesses, access{id, networkRestrictions, statement, i})
+			}
+			for _, service := range statement.Principal.services() {
+				serviceAccesses = append(serviceAccesses, serviceAccess{statement.grant(service, window, i), i})
+			}
+		case statement.Effect == EffectDeny:
+			if rule := statement.denyRule(); rule != nil {
+				rule.index = i
+				rules = append(rules, rule)
+			}
+		}
+	}
+	result.OrphanedPrincipals = sortedKeys(orphaned)
+	result.AccessPointAccounts = sortedKeys(accessPointAccounts)
+	result.HasAccess = len(accesses) > 0 || len(serviceAccesses) > 0 || len(inactiveGrants) > 0 ||
+		len(orphaned) > 0
+
+	// a wildcard grant narrowed by a Deny is replaced by the accounts or
+	// organizations exempted from that Deny
+	narrowed := []access{}
+	for _, a := range accesses {
+		narrowed = append(narrowed, a)
+		if a.id != Wildcard {
+			continue
+		}
+		for _, rule := range rules {
+			if !rule.coversResources(a.statement) {
+				continue
+			}
+			for _, id := range rule.narrows() {
+				narrowed = append(narrowed, access{id, a.networkRestrictions, a.statement, a.index})
+			}
+		}
+	}
+	isDenied := func(a access) bool {
+		for _, rule := range rules {
+			if rule.applies(a.id, a.statement, ctx) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, a := range accesses {
+		for _, rule := range rules {
+			if rule.applies(a.id, a.statement, ctx) {
+				result.NarrowedByDeny = true
+				evidence[rule.index] = true
+			}
+		}
+	}
+
+	inOrg := map[string]bool{}
+	external := map[string]bool{}
+	networks := map[string]bool{}
+	unevaluatedKeys := map[string]bool{}
+	grants := []Grant{}
+	for _, a := range narrowed {
+		if isDenied(a) || a.id == ctx.Account {
+			continue
+		}
+		grants = append(grants, a.statement.grant(a.id, a.statement.Condition.timeWindow(ctx.Now), a.index))
+		evidence[a.index] = true
+		switch {
+		case a.id == Wildcard && len(a.networkRestrictions) == 0:
+			keys := a.statement.Condition.unevaluatedKeys()
+			if a.statement.isUnrestrictedWebIdentity() {
+				// the provider's claims were evaluated, and do not restrict
+				// who can assume the role
+				keys = nil
+			}
+			if len(keys) == 0 {
+				result.PublicAccess = UnconditionallyPublic
+			} else if result.PublicAccess == NotPublic {
+				result.PublicAccess = ConditionallyPublic
+			}
+			for _, key := range keys {
+				unevaluatedKeys[key] = true
+			}
+		case a.id == Wildcard:
+			for _, network := range a.networkRestrictions {
+				networks[network] = true
+			}
+		case ctx.InOrg(a.id):
+			inOrg[a.id] = true
+		default:
+			external[a.id] = true
+		}
+	}
+	services := map[string]bool{}
+	for _, sa := range serviceAccesses {
+		if denyAll(rules, &p.Statement[sa.index]) {
+			continue
+		}
+		grants = append(grants, sa.grant)
+		services[sa.grant.Principal] = true
+		evidence[sa.index] = true
+	}
+	result.Services = sortedKeys(services)
+	result.Findings = sortedKeys(findings)
+	if result.PublicAccess == ConditionallyPublic {
+		result.UnevaluatedConditionKeys = sortedKeys(unevaluatedKeys)
+	}
+	result.InOrgAccounts = sortedKeys(inOrg)
+	result.ExternalAccounts = sortedKeys(external)
+	result.NetworkRestrictions = sortedKeys(networks)
+	result.Grants = append(grants, inactiveGrants...)
+	for i := range p.Statement {
+		if evidence[i] {
+			result.Evidence = append(result.Evidence, p.Statement[i].evidence())
+		}
+	}
+	return result
+}
+
+// denyAll returns true if any rule removes the access an Allow statement
+// grants to everyone, including service principals
+func denyAll(rules []*denyRule, allow *Statement) bool {
+	for _, rule := range rules {
+		if rule.scope == denyPrincipals && contains(rule.values, Wildcard) && rule.coversResources(allow) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,412 @@
+package policy
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testContext is the account and organization the fixtures are evaluated
+// for. 222222222222 is in the organization, 333333333333 is not.
+func testContext() *Context {
+	return &Context{
+		Account:      "111111111111",
+		Organization: "o-abc123def4",
+		OrgAccounts: map[string]bool{
+			"111111111111": true,
+			"222222222222": true,
+		},
+		Now: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func loadFixture(t *testing.T, name string) *Policy {
+	t.Helper()
+	document, err := ioutil.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %v: %v", name, err)
+	}
+	p, err := Parse(document)
+	if err != nil {
+		t.Fatalf("Failed to parse fixture %v: %v", name, err)
+	}
+	return p
+}
+
+// expectedResult lists the fields of a Result checked for each fixture
+type expectedResult struct {
+	HasAccess                bool
+	PublicAccess             PublicAccess
+	UnevaluatedConditionKeys []string
+	NetworkRestrictions      []string
+	InOrgAccounts            []string
+	ExternalAccounts         []string
+	Services                 []string
+	NarrowedByDeny           bool
+	Findings                 []string
+	OrphanedPrincipals       []string
+	Evidence                 []int
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		expected expectedResult
+	}{
+		{
+			fixture: "deny_outside_accounts",
+			expected: expectedResult{
+				HasAccess:      true,
+				PublicAccess:   NotPublic,
+				InOrgAccounts:  []string{"222222222222"},
+				NarrowedByDeny: true,
+				Evidence:       []int{0, 1},
+			},
+		},
+		{
+			fixture: "deny_outside_org",
+			expected: expectedResult{
+				HasAccess:      true,
+				PublicAccess:   NotPublic,
+				InOrgAccounts:  []string{"o-abc123def4"},
+				NarrowedByDeny: true,
+				Evidence:       []int{0, 1},
+			},
+		},
+		{
+			fixture: "deny_account_root",
+			expected: expectedResult{
+				HasAccess:      true,
+				PublicAccess:   NotPublic,
+				NarrowedByDeny: true,
+				Evidence:       []int{1},
+			},
+		},
+		{
+			fixture: "deny_single_role",
+			expected: expectedResult{
+				HasAccess:        true,
+				PublicAccess:     NotPublic,
+				ExternalAccounts: []string{"333333333333"},
+				Evidence:         []int{0},
+			},
+		},
+		{
+			fixture: "deny_partial_actions",
+			expected: expectedResult{
+				HasAccess:        true,
+				PublicAccess:     NotPublic,
+				ExternalAccounts: []string{"333333333333"},
+				Evidence:         []int{0},
+			},
+		},
+		{
+			fixture: "deny_partial_resource",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: UnconditionallyPublic,
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "deny_not_resource",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: UnconditionallyPublic,
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "deny_covering_resource",
+			expected: expectedResult{
+				HasAccess:      true,
+				PublicAccess:   NotPublic,
+				NarrowedByDeny: true,
+				Evidence:       []int{1},
+			},
+		},
+		{
+			fixture: "not_principal",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: UnconditionallyPublic,
+				Findings:     []string{FindingAllowNotPrincipal},
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "not_action",
+			expected: expectedResult{
+				HasAccess:        true,
+				PublicAccess:     NotPublic,
+				ExternalAccounts: []string{"333333333333"},
+				Findings:         []string{FindingAllowNotAction},
+				Evidence:         []int{0},
+			},
+		},
+		{
+			fixture: "org_condition",
+			expected: expectedResult{
+				HasAccess:     true,
+				PublicAccess:  NotPublic,
+				InOrgAccounts: []string{"o-abc123def4"},
+				Evidence:      []int{0},
+			},
+		},
+		{
+			fixture: "other_org_condition",
+			expected: expectedResult{
+				HasAccess:        true,
+				PublicAccess:     NotPublic,
+				ExternalAccounts: []string{"o-zzzzzzzzzz"},
+				Evidence:         []int{0},
+			},
+		},
+		{
+			fixture: "resource_org_condition",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: UnconditionallyPublic,
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "account_condition",
+			expected: expectedResult{
+				HasAccess:        true,
+				PublicAccess:     NotPublic,
+				InOrgAccounts:    []string{"222222222222"},
+				ExternalAccounts: []string{"333333333333"},
+				Evidence:         []int{0},
+			},
+		},
+		{
+			fixture: "wildcard_account_condition",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: UnconditionallyPublic,
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "if_exists",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: UnconditionallyPublic,
+				Findings:     []string{FindingIneffectiveCondition},
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "for_all_values",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: UnconditionallyPublic,
+				Findings:     []string{FindingIneffectiveCondition},
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "unevaluated_condition",
+			expected: expectedResult{
+				HasAccess:                true,
+				PublicAccess:             ConditionallyPublic,
+				UnevaluatedConditionKeys: []string{"s3:x-amz-acl"},
+				Evidence:                 []int{0},
+			},
+		},
+		{
+			fixture: "network_source_ip",
+			expected: expectedResult{
+				HasAccess:           true,
+				PublicAccess:        NotPublic,
+				NetworkRestrictions: []string{"198.51.100.7/32", "203.0.113.0/24"},
+				Evidence:            []int{0},
+			},
+		},
+		{
+			fixture: "network_source_vpce",
+			expected: expectedResult{
+				HasAccess:           true,
+				PublicAccess:        NotPublic,
+				NetworkRestrictions: []string{"vpce-1a2b3c4d"},
+				Evidence:            []int{0},
+			},
+		},
+		{
+			fixture: "network_broad_cidr",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: UnconditionallyPublic,
+				Findings:     []string{FindingBroadNetworkCondition},
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "date_expired",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: NotPublic,
+				Findings:     []string{FindingExpiredGrant},
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "date_future",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: NotPublic,
+				Findings:     []string{FindingFutureGrant},
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "date_active",
+			expected: expectedResult{
+				HasAccess:        true,
+				PublicAccess:     NotPublic,
+				ExternalAccounts: []string{"333333333333"},
+				Evidence:         []int{0},
+			},
+		},
+		{
+			fixture: "orphaned",
+			expected: expectedResult{
+				HasAccess:          true,
+				PublicAccess:       NotPublic,
+				InOrgAccounts:      []string{"222222222222"},
+				Findings:           []string{FindingOrphanedPrincipal},
+				OrphanedPrincipals: []string{"AROAJ2UCCR6DPCEXAMPLE"},
+				Evidence:           []int{0},
+			},
+		},
+		{
+			fixture: "oidc_unrestricted",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: UnconditionallyPublic,
+				Findings:     []string{FindingUnrestrictedWebIdentity},
+				Evidence:     []int{0},
+			},
+		},
+		{
+			fixture: "oidc_restricted",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: NotPublic,
+			},
+		},
+		{
+			fixture: "assume_role_external",
+			expected: expectedResult{
+				HasAccess:        true,
+				PublicAccess:     NotPublic,
+				ExternalAccounts: []string{"333333333333"},
+				Evidence:         []int{0},
+			},
+		},
+		{
+			fixture: "service_without_source",
+			expected: expectedResult{
+				HasAccess:    true,
+				PublicAccess: NotPublic,
+				Services:     []string{"sns.amazonaws.com"},
+				Findings:     []string{FindingServiceConfusedDeputy},
+				Evidence:     []int{0},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			result := Evaluate(loadFixture(t, test.fixture), testContext())
+			evidence := []int{}
+			for _, e := range result.Evidence {
+				evidence = append(evidence, e.Index)
+			}
+			actual := expectedResult{
+				HasAccess:                result.HasAccess,
+				PublicAccess:             result.PublicAccess,
+				NetworkRestrictions:      result.NetworkRestrictions,
+				UnevaluatedConditionKeys: result.UnevaluatedConditionKeys,
+				InOrgAccounts:            result.InOrgAccounts,
+				ExternalAccounts:         result.ExternalAccounts,
+				Services:                 result.Services,
+				NarrowedByDeny:           result.NarrowedByDeny,
+				Findings:                 result.Findings,
+				OrphanedPrincipals:       result.OrphanedPrincipals,
+				Evidence:                 evidence,
+			}
+			if !reflect.DeepEqual(normalize(actual), normalize(test.expected)) {
+				t.Errorf("Unexpected result\n got: %+v\nwant: %+v", actual, test.expected)
+			}
+		})
+	}
+}
+
+// normalize treats nil and empty lists as equal
+func normalize(r expectedResult) expectedResult {
+	for _, list := range []*[]string{&r.UnevaluatedConditionKeys, &r.NetworkRestrictions, &r.InOrgAccounts, &r.ExternalAccounts, &r.Services, &r.Findings, &r.OrphanedPrincipals} {
+		if len(*list) == 0 {
+			*list = nil
+		}
+	}
+	if len(r.Evidence) == 0 {
+		r.Evidence = nil
+	}
+	return r
+}
+
+func TestRoleTrustFindings(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		expected []string
+	}{
+		{"assume_role_external", []string{FindingMissingExternalID}},
+		{"assume_role_external_id", nil},
+		{"assume_role_in_org", nil},
+		{"date_expired", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			ctx := testContext()
+			p := loadFixture(t, test.fixture)
+			findings := RoleTrustFindings(p, Evaluate(p, ctx), ctx)
+			if !reflect.DeepEqual(findings, test.expected) {
+				t.Errorf("Unexpected findings %v, want %v", findings, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseSingleStatement(t *testing.T) {
+	p := loadFixture(t, "single_statement")
+	if len(p.Statement) != 1 || p.DroppedStatements != 0 {
+		t.Errorf("Parsed %v statements and dropped %v, want 1 and 0", len(p.Statement), p.DroppedStatements)
+	}
+}
+
+func TestParseDropsInvalidStatements(t *testing.T) {
+	p := loadFixture(t, "dropped_statement")
+	if len(p.Statement) != 1 || p.DroppedStatements != 1 {
+		t.Errorf("Parsed %v statements and dropped %v, want 1 and 1", len(p.Statement), p.DroppedStatements)
+	}
+	result := Evaluate(p, testContext())
+	if !reflect.DeepEqual(result.ExternalAccounts, []string{"333333333333"}) {
+		t.Errorf("Unexpected external accounts %v", result.ExternalAccounts)
+	}
+}
+
+func TestEvidenceKeepsStatementPositions(t *testing.T) {
+	p := loadFixture(t, "dropped_first_statement")
+	result := Evaluate(p, testContext())
+	references := []string{}
+	for _, e := range result.Evidence {
+		references = append(references, e.Reference())
+	}
+	expected := []string{"Statement[1] (Vendor)"}
+	if !reflect.DeepEqual(references, expected) {
+		t.Errorf("Unexpected evidence %v, want %v", references, expected)
+	}
+}
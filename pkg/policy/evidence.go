@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Evidence describes a statement that contributes to a Result, so that
+// reviewers can act on a finding without looking up the policy
+type Evidence struct {
+	// Index is the zero-based position of the statement in its policy
+	// document
+	Index int
+	// Document names the policy document, for resources with several
+	Document string
+	Sid      string
+	Effect   string
+	// Principals lists the statement's principals as Type:ID, prefixed
+	// with NotPrincipal when the statement excludes them instead
+	Principals []string
+	// Actions lists the statement's actions, prefixed with NotAction when
+	// the statement excludes them instead
+	Actions []string
+	// Conditions lists each condition as operator, key and values
+	Conditions []string
+}
+
+// Reference returns a short reference to the statement, for instance
+// Statement[2] (AllowVendorRead), prefixed with its document when the
+// resource has several
+func (e *Evidence) Reference() string {
+	reference := fmt.Sprintf("Statement[%v]", e.Index)
+	if e.Document != "" {
+		reference = e.Document + " " + reference
+	}
+	if e.Sid == "" {
+		return reference
+	}
+	return fmt.Sprintf("%v (%v)", reference, e.Sid)
+}
+
+func describePrincipal(p *Principal, prefix string) []string {
+	if p == nil {
+		return nil
+	}
+	if p.Invalid {
+		return []string{prefix + "<invalid>"}
+	}
+	described := []string{}
+	for _, identity := range p.Identities() {
+		if p.Wildcard && identity.ID == Wildcard && identity.Type == PrincipalAWS {
+			described = append(described, prefix+Wildcard)
+			continue
+		}
+		described = append(described, prefix+identity.Type+":"+identity.ID)
+	}
+	return described
+}
+
+// describe returns each condition as operator, key and values, keeping the
+// case used in the policy
+func (c Conditions) describe() []string {
+	described := []string{}
+	for operator, keys := range c {
+		for key, values := range keys {
+			described = append(described, fmt.Sprintf("%v %v [%v]", operator, key, strings.Join(values, ", ")))
+		}
+	}
+	sort.Strings(described)
+	return described
+}
+
+// StatementEvidence returns the Evidence for p.Statement[index], for
+// findings raised outside of Evaluate
+func (p *Policy) StatementEvidence(index int) Evidence {
+	return p.Statement[index].evidence()
+}
+
+func (s *Statement) evidence() Evidence {
+	principals := describePrincipal(s.Principal, "")
+	principals = append(principals, describePrincipal(s.NotPrincipal, "NotPrincipal ")...)
+	actions := append([]string{}, s.Action...)
+	for _, action := range s.NotAction {
+		actions = append(actions, "NotAction "+action)
+	}
+	return Evidence{
+		Index:      s.Index,
+		Document:   s.Document,
+		Sid:        s.Sid,
+		Effect:     s.Effect,
+		Principals: principals,
+		Actions:    actions,
+		Conditions: s.Condition.describe(),
+	}
+}
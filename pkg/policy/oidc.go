@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"regexp"
+	"strings"
+)
+
+var oidcProviderPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:oidc-provider/(.+)$`)
+
+// Actions used to assume a role. Web identity tokens are issued by an OIDC
+// identity provider.
+const (
+	assumeRoleAction  = "sts:assumerole"
+	webIdentityAction = "sts:assumerolewithwebidentity"
+)
+
+// oidcProviders returns the OIDC identity providers, such as
+// token.actions.githubusercontent.com, whose tokens the statement allows to
+// assume a role
+func (s *Statement) oidcProviders() []string {
+	if s.Effect != EffectAllow || s.Principal == nil || !s.allowsAction(webIdentityAction) {
+		return nil
+	}
+	providers := []string{}
+	for _, identity := range s.Principal.Identities() {
+		if identity.Type != PrincipalFederated {
+			continue
+		}
+		if match := oidcProviderPattern.FindStringSubmatch(identity.ID); match != nil {
+			providers = append(providers, match[1])
+		}
+	}
+	return providers
+}
+
+// isBroadSubject returns true if a wildcard in a token subject matches
+// subjects of any owner, e.g. repo:*, or organization:* for Terraform Cloud.
+// Subjects are of the form kind:owner..., so the wildcard must come before
+// or at the start of the owner.
+func isBroadSubject(value string) bool {
+	segments := strings.SplitN(value, ":", 3)
+	if strings.ContainsAny(segments[0], "*?") {
+		return true
+	}
+	return len(segments) > 1 && (segments[1] == "" || strings.ContainsAny(segments[1][:1], "*?"))
+}
+
+// restrictsWebIdentity returns true if the conditions tie the tokens of an
+// OIDC provider to specific subjects. Providers such as GitHub Actions, EKS
+// and Terraform Cloud issue tokens with the same audience to everyone, so
+// only the sub claim restricts who can assume the role. A wildcard aud
+// condition is flagged as well, as it accepts tokens meant for any client.
+func (c Conditions) restrictsWebIdentity(provider string) bool {
+	subKey := strings.ToLower(provider) + ":sub"
+	audKey := strings.ToLower(provider) + ":aud"
+	restricted := false
+	for _, entry := range c.Entries() {
+		if !positiveOperators[entry.Operator] || !entry.restricts() {
+			continue
+		}
+		isLike := entry.Operator == "stringlike"
+		switch entry.Key {
+		case subKey:
+			narrow := true
+			for _, value := range entry.Values {
+				if isLike && isBroadSubject(value) {
+					narrow = false
+				}
+			}
+			restricted = restricted || narrow
+		case audKey:
+			for _, value := range entry.Values {
+				if isLike && strings.Trim(value, "*?") == "" {
+					return false
+				}
+			}
+		}
+	}
+	return restricted
+}
+
+// isUnrestrictedWebIdentity returns true if the statement lets anyone with a
+// token from one of its OIDC providers assume the role
+func (s *Statement) isUnrestrictedWebIdentity() bool {
+	for _, provider := range s.oidcProviders() {
+		if !s.Condition.restrictsWebIdentity(provider) {
+			return true
+		}
+	}
+	return false
+}
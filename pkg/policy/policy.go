@@ -0,0 +1,134 @@
+// Package policy parses IAM policy documents into typed statements and
+// evaluates who they grant access to.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Effects a Statement can have
+const (
+	EffectAllow = "Allow"
+	EffectDeny  = "Deny"
+)
+
+// Policy is an IAM policy document, such as a resource policy
+type Policy struct {
+	Version   string
+	ID        string `json:"Id"`
+	Statement []Statement
+	// DroppedStatements counts statements that could not be parsed, and so
+	// are not evaluated
+	DroppedStatements int `json:"-"`
+}
+
+// Statement is a single statement of a policy. Principal and NotPrincipal
+// are nil when the statement does not include them.
+type Statement struct {
+	// Index is the zero-based position of the statement in its policy
+	// document, counting statements that could not be parsed
+	Index int `json:"-"`
+	// Document names the policy document the statement came from, for
+	// resources with several policies. It is empty otherwise.
+	Document     string `json:"-"`
+	Sid          string
+	Effect       string
+	Principal    *Principal
+	NotPrincipal *Principal
+	Action       Values
+	NotAction    Values
+	Resource     Values
+	NotResource  Values
+	Condition    Conditions
+}
+
+// Values is a policy element that can be given as either a single value or
+// an array of values. Numbers and booleans are kept as their string form,
+// as IAM compares them as strings.
+type Values []string
+
+func (v *Values) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var raw []json.RawMessage
+		err := json.Unmarshal(data, &raw)
+		if err != nil {
+			return err
+		}
+		values := make(Values, 0, len(raw))
+		for _, r := range raw {
+			value, err := scalarString(r)
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+		}
+		*v = values
+		return nil
+	}
+	value, err := scalarString(data)
+	if err != nil {
+		return err
+	}
+	*v = Values{value}
+	return nil
+}
+
+func scalarString(data json.RawMessage) (string, error) {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return "", err
+	}
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), nil
+	default:
+		return "", errors.Errorf("Expected a string, number or boolean, found %v", string(data))
+	}
+}
+
+// Parse parses an IAM policy document. Statements are parsed one at a time,
+// so that a single malformed statement does not hide the rest of the policy;
+// those that fail to parse are counted in DroppedStatements. IAM allows a
+// single statement to be given as an object rather than an array.
+func Parse(document []byte) (*Policy, error) {
+	raw := struct {
+		Version   string
+		ID        string `json:"Id"`
+		Statement json.RawMessage
+	}{}
+	err := json.Unmarshal(document, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse policy")
+	}
+	policy := &Policy{Version: raw.Version, ID: raw.ID}
+	statements := []json.RawMessage{}
+	data := bytes.TrimSpace(raw.Statement)
+	if len(data) > 0 && data[0] == '{' {
+		statements = append(statements, data)
+	} else if len(data) > 0 && !bytes.Equal(data, []byte("null")) {
+		err = json.Unmarshal(data, &statements)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to parse policy statements")
+		}
+	}
+	for i, rawStatement := range statements {
+		var statement Statement
+		if json.Unmarshal(rawStatement, &statement) != nil {
+			policy.DroppedStatements++
+			continue
+		}
+		statement.Index = i
+		policy.Statement = append(policy.Statement, statement)
+	}
+	return policy, nil
+}
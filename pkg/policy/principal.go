@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Principal types, as used as keys of a Principal element
+const (
+	PrincipalAWS           = "AWS"
+	PrincipalService       = "Service"
+	PrincipalFederated     = "Federated"
+	PrincipalCanonicalUser = "CanonicalUser"
+)
+
+// Wildcard is used in place of an account id for access granted to everyone
+const Wildcard = "*"
+
+// Principal is a Principal or NotPrincipal element. It is either "*", or an
+// object keyed by principal type whose values are a single string or an
+// array. Elements of any other shape are recorded as Invalid.
+type Principal struct {
+	Wildcard bool
+	ByType   map[string]Values
+	Invalid  bool
+}
+
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		byType := map[string]Values{}
+		err := json.Unmarshal(data, &byType)
+		if err != nil {
+			p.Invalid = true
+			return nil
+		}
+		p.ByType = byType
+		return nil
+	}
+	var s string
+	if json.Unmarshal(data, &s) == nil && s == Wildcard {
+		p.Wildcard = true
+		return nil
+	}
+	p.Invalid = true
+	return nil
+}
+
+// Identity is a single normalized principal
+type Identity struct {
+	Type string
+	ID   string
+}
+
+// Identities normalizes every form of the principal into a flat, sorted list.
+// "*" is the same as {"AWS": "*"}.
+func (p *Principal) Identities() []Identity {
+	if p == nil {
+		return nil
+	}
+	identities := []Identity{}
+	if p.Wildcard {
+		identities = append(identities, Identity{Type: PrincipalAWS, ID: Wildcard})
+	}
+	types := make([]string, 0, len(p.ByType))
+	for principalType := range p.ByType {
+		types = append(types, principalType)
+	}
+	sort.Strings(types)
+	for _, principalType := range types {
+		for _, id := range p.ByType[principalType] {
+			identities = append(identities, Identity{Type: principalType, ID: id})
+		}
+	}
+	return identities
+}
+
+var iamArnPattern = regexp.MustCompile(`^arn:aws[a-z-]*:(iam|sts)::[0-9]{12}:`)
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// uniqueIDPattern matches the unique ids of IAM users, roles and other
+// identities. AWS replaces the ARN of a principal with its unique id when
+// the identity is deleted.
+var uniqueIDPattern = regexp.MustCompile(`^(AIDA|AROA|AIPA|ANPA|ANVA|AGPA)[A-Z0-9]{12,}$`)
+
+// IsOrphaned returns true if the identity is the unique id of a deleted IAM
+// identity, which no longer grants access to anyone
+func (i Identity) IsOrphaned() bool {
+	return i.Type == PrincipalAWS && uniqueIDPattern.MatchString(i.ID)
+}
+
+// AccountID returns the account id an identity belongs to, Wildcard for
+// everyone, or "" if it cannot be classified. Identities that are not tied to
+// an account are returned as-is, or with a prefix, so they show up as
+// external: canonical users, and identity providers outside of IAM such as
+// accounts.google.com or cognito-identity.amazonaws.com. Service principals
+// are not tied to an account, and return "".
+func (i Identity) AccountID() string {
+	switch {
+	case i.Type == PrincipalAWS && i.ID == Wildcard:
+		return Wildcard
+	case i.Type == PrincipalAWS && accountIDPattern.MatchString(i.ID):
+		return i.ID
+	case (i.Type == PrincipalAWS || i.Type == PrincipalFederated) && iamArnPattern.MatchString(i.ID):
+		return arnAccountID(i.ID)
+	case i.Type == PrincipalFederated && !strings.HasPrefix(i.ID, "arn:"):
+		return i.ID
+	case i.Type == PrincipalCanonicalUser:
+		return "canonical-user:" + i.ID
+	default:
+		return ""
+	}
+}
+
+func arnAccountID(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 5 {
+		return ""
+	}
+	return parts[4]
+}
+
+// accountIDs returns the account ids named by the principal, skipping
+// identities that are not tied to an account
+func (p *Principal) accountIDs() []string {
+	ids := []string{}
+	for _, identity := range p.Identities() {
+		if id := identity.AccountID(); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+var rootArnPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:root$`)
+
+// accountLevelIDs returns the account ids, or Wildcard, of identities that
+// stand for every principal of an account: "*", a bare account id, or the
+// account's root ARN. Individual users and roles are skipped.
+func (p *Principal) accountLevelIDs() []string {
+	ids := []string{}
+	for _, identity := range p.Identities() {
+		if identity.Type != PrincipalAWS {
+			continue
+		}
+		if identity.ID == Wildcard || accountIDPattern.MatchString(identity.ID) ||
+			rootArnPattern.MatchString(identity.ID) {
+			ids = append(ids, identity.AccountID())
+		}
+	}
+	return ids
+}
+
+// orphaned returns the unique ids of deleted IAM identities named by the
+// principal
+func (p *Principal) orphaned() []string {
+	orphaned := []string{}
+	for _, identity := range p.Identities() {
+		if identity.IsOrphaned() {
+			orphaned = append(orphaned, identity.ID)
+		}
+	}
+	return orphaned
+}
+
+// services returns the service principals, such as sns.amazonaws.com
+func (p *Principal) services() []string {
+	services := []string{}
+	for _, identity := range p.Identities() {
+		if identity.Type == PrincipalService {
+			services = append(services, identity.ID)
+		}
+	}
+	return services
+}
+
+// unparsed returns true if the statement has a principal that cannot be
+// classified, either because it is missing, of an unexpected shape, or names
+// an unrecognized identity. Unique ids of deleted identities are recognized
+// as orphaned.
+func (s *Statement) unparsed() bool {
+	principal := s.Principal
+	if principal == nil {
+		principal = s.NotPrincipal
+	}
+	if principal == nil || principal.Invalid {
+		return true
+	}
+	for _, identity := range principal.Identities() {
+		if identity.Type != PrincipalService && !identity.IsOrphaned() && identity.AccountID() == "" {
+			return true
+		}
+	}
+	return false
+}
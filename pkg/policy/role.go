@@ -0,0 +1,21 @@
+package policy
+
+// RoleTrustFindings returns the findings specific to an IAM role's trust
+// policy, given the result of evaluating it. An external account allowed to
+// call sts:AssumeRole without an sts:ExternalId or MFA condition can be used
+// as a confused deputy by any of its own customers.
+func RoleTrustFindings(p *Policy, result *Result, ctx *Context) []string {
+	for _, grant := range result.Grants {
+		isExternal := grant.Principal != Wildcard && grant.Principal != ctx.Account &&
+			!ctx.InOrg(grant.Principal) && !contains(result.Services, grant.Principal)
+		isInEffect := grant.Window != TimeExpired && grant.Window != TimeFuture
+		if !isExternal || !isInEffect {
+			continue
+		}
+		statement := &p.Statement[grant.Statement]
+		if statement.allowsAction(assumeRoleAction) && !statement.Condition.hasConfusedDeputyProtection() {
+			return []string{FindingMissingExternalID}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package policy
+
+import (
+	"strconv"
+	"time"
+)
+
+// TimeWindow describes whether a grant bound by date conditions is in effect
+type TimeWindow string
+
+const (
+	// NotTimeBound grants have no date conditions on the current time
+	NotTimeBound TimeWindow = ""
+	// TimeActive grants are bound by date conditions that are currently met
+	TimeActive TimeWindow = "active"
+	// TimeExpired grants ended before the account was imported
+	TimeExpired TimeWindow = "expired"
+	// TimeFuture grants do not start until after the account was imported
+	TimeFuture TimeWindow = "future"
+)
+
+var timeConditionKeys = map[string]bool{
+	"aws:currenttime": true,
+	"aws:epochtime":   true,
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseDate parses a date condition value, which IAM accepts either as an
+// ISO 8601 date, optionally with a time, or as seconds since the epoch
+func parseDate(value string) (time.Time, bool) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timeWindow compares the conditions on aws:CurrentTime and aws:EpochTime
+// against now. A condition matches if any of its values does, and values
+// that cannot be parsed are assumed to match, so that grants are only
+// reported as expired or future when that is certain. A zero now treats
+// every time-bound grant as active.
+func (c Conditions) timeWindow(now time.Time) TimeWindow {
+	window := NotTimeBound
+	expired := false
+	future := false
+	for _, entry := range c.Entries() {
+		if !timeConditionKeys[entry.Key] {
+			continue
+		}
+		var matches func(t time.Time) bool
+		switch entry.Operator {
+		case "datelessthan":
+			matches = func(t time.Time) bool { return now.Before(t) }
+		case "datelessthanequals":
+			matches = func(t time.Time) bool { return !now.After(t) }
+		case "dategreaterthan":
+			matches = func(t time.Time) bool { return now.After(t) }
+		case "dategreaterthanequals":
+			matches = func(t time.Time) bool { return !now.Before(t) }
+		default:
+			continue
+		}
+		window = TimeActive
+		if now.IsZero() {
+			continue
+		}
+		anyMatch := false
+		for _, value := range entry.Values {
+			t, ok := parseDate(value)
+			if !ok || matches(t) {
+				anyMatch = true
+				break
+			}
+		}
+		if !anyMatch {
+			isUpperBound := entry.Operator == "datelessthan" || entry.Operator == "datelessthanequals"
+			expired = expired || isUpperBound
+			future = future || !isUpperBound
+		}
+	}
+	switch {
+	case expired:
+		return TimeExpired
+	case future:
+		return TimeFuture
+	default:
+		return window
+	}
+}
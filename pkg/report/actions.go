@@ -0,0 +1,266 @@
+package report
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+// Access levels, as used by the IAM documentation to classify actions
+const (
+	AccessLevelList                  = "List"
+	AccessLevelRead                  = "Read"
+	AccessLevelWrite                 = "Write"
+	AccessLevelPermissionsManagement = "Permissions management"
+	AccessLevelTagging               = "Tagging"
+)
+
+var accessLevelOrder = []string{
+	AccessLevelList,
+	AccessLevelRead,
+	AccessLevelWrite,
+	AccessLevelPermissionsManagement,
+	AccessLevelTagging,
+}
+
+// Grant lists the actions a single principal is allowed to take on a
+// resource, along with their access levels
+type Grant struct {
+	Principal    string
+	Actions      []string
+	AccessLevels []string
+	// Window is whether the date conditions of the statements making this
+	// grant are in effect, or "" if they have none
+	Window policy.TimeWindow
+	// Constraints lists conditions the grant is limited by, such as the
+	// encryption context constraints of a KMS grant
+	Constraints []string
+}
+
+// inEffect returns true unless the grant's date conditions have expired or
+// are not yet active
+func (g *Grant) inEffect() bool {
+	return g.Window != policy.TimeExpired && g.Window != policy.TimeFuture
+}
+
+// actionCatalog maps an IAM service prefix, such as s3, to the service's
+// actions and their access levels
+type actionCatalog map[string]map[string]string
+
+// servicePrefixes maps services whose IAM action prefix differs from the
+// name the introspector uses for them
+var servicePrefixes = map[string]string{
+	"apigateway": "execute-api",
+	"efs":        "elasticfilesystem",
+	// only role trust policies are imported for iam, and they grant the
+	// sts actions used to assume the role
+	"iam": "sts",
+	// access point policies use the s3 actions
+	"s3control": "s3",
+}
+
+func servicePrefix(service string) string {
+	if prefix, ok := servicePrefixes[service]; ok {
+		return prefix
+	}
+	return service
+}
+
+func loadActionCatalog() (actionCatalog, error) {
+	filename := "/catalog/actions.json"
+	f, err := pkger.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open %v", filename)
+	}
+	defer f.Close()
+	catalog := actionCatalog{}
+	err = json.NewDecoder(f).Decode(&catalog)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %v", filename)
+	}
+	return catalog, nil
+}
+
+func actionPattern(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("(?i)^" + quoted + "$")
+}
+
+func splitAction(action string) (string, string) {
+	parts := strings.SplitN(action, ":", 2)
+	if len(parts) == 1 {
+		return "", parts[0]
+	}
+	return strings.ToLower(parts[0]), parts[1]
+}
+
+// expand returns the catalog actions matched by an action pattern, which may
+// use wildcards. A bare "*" matches every action of the resource's service.
+// Patterns that match nothing in the catalog are returned as-is.
+func (c actionCatalog) expand(service string, pattern string) []string {
+	if pattern == "*" {
+		pattern = servicePrefix(service) + ":*"
+	}
+	prefix, name := splitAction(pattern)
+	actions, ok := c[prefix]
+	if !ok {
+		return []string{pattern}
+	}
+	matcher := actionPattern(name)
+	matched := []string{}
+	for action := range actions {
+		if matcher.MatchString(action) {
+			matched = append(matched, prefix+":"+action)
+		}
+	}
+	if len(matched) == 0 {
+		return []string{pattern}
+	}
+	return matched
+}
+
+// expandNot returns the catalog actions of the resource's service that are
+// not matched by any of the excluded patterns, as allowed by NotAction
+func (c actionCatalog) expandNot(service string, excluded []string) []string {
+	prefix := servicePrefix(service)
+	actions, ok := c[prefix]
+	if !ok {
+		return []string{prefix + ":*"}
+	}
+	matchers := make([]*regexp.Regexp, len(excluded))
+	for i, pattern := range excluded {
+		matchers[i] = actionPattern(pattern)
+	}
+	allowed := []string{}
+	for action := range actions {
+		qualified := prefix + ":" + action
+		isExcluded := false
+		for _, matcher := range matchers {
+			if matcher.MatchString(qualified) {
+				isExcluded = true
+				break
+			}
+		}
+		if !isExcluded {
+			allowed = append(allowed, qualified)
+		}
+	}
+	return allowed
+}
+
+// accessLevels returns the access levels of an action, falling back to
+// guessing from the action's name when it is not in the catalog. An
+// unexpanded wildcard covering a whole service has every access level.
+func (c actionCatalog) accessLevels(action string) []string {
+	prefix, name := splitAction(action)
+	if actions, ok := c[prefix]; ok {
+		for catalogAction, level := range actions {
+			if strings.EqualFold(catalogAction, name) {
+				return []string{level}
+			}
+		}
+	}
+	if name == "*" {
+		return accessLevelOrder
+	}
+	return []string{guessAccessLevel(name)}
+}
+
+func guessAccessLevel(name string) string {
+	hasPrefix := func(prefixes ...string) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(name, p) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case hasPrefix("List", "Describe"):
+		return AccessLevelList
+	case hasPrefix("Tag", "Untag"):
+		return AccessLevelTagging
+	case strings.Contains(name, "Policy") || strings.Contains(name, "Permission"):
+		if hasPrefix("Get") {
+			return AccessLevelRead
+		}
+		return AccessLevelPermissionsManagement
+	case hasPrefix("Get", "Read", "Head", "Search", "Select"):
+		return AccessLevelRead
+	default:
+		return AccessLevelWrite
+	}
+}
+
+func sortAccessLevels(levels map[string]bool) []string {
+	sorted := []string{}
+	for _, level := range accessLevelOrder {
+		if levels[level] {
+			sorted = append(sorted, level)
+		}
+	}
+	return sorted
+}
+
+// buildGrants merges the per-statement grants for a resource into a single
+// Grant per principal and time window, and returns the access levels across
+// all grants in effect
+func (c actionCatalog) buildGrants(service string, statementGrants []policy.Grant) ([]Grant, []string) {
+	type grantKey struct {
+		principal string
+		window    policy.TimeWindow
+	}
+	byPrincipal := map[grantKey]map[string]bool{}
+	for _, sg := range statementGrants {
+		key := grantKey{sg.Principal, sg.Window}
+		actions, ok := byPrincipal[key]
+		if !ok {
+			actions = map[string]bool{}
+			byPrincipal[key] = actions
+		}
+		if len(sg.NotActions) > 0 {
+			for _, action := range c.expandNot(service, sg.NotActions) {
+				actions[action] = true
+			}
+		}
+		for _, pattern := range sg.Actions {
+			for _, action := range c.expand(service, pattern) {
+				actions[action] = true
+			}
+		}
+	}
+	grants := make([]Grant, 0, len(byPrincipal))
+	allLevels := map[string]bool{}
+	for key, actions := range byPrincipal {
+		levels := map[string]bool{}
+		grant := Grant{Principal: key.principal, Window: key.window}
+		inEffect := key.window != policy.TimeExpired && key.window != policy.TimeFuture
+		for action := range actions {
+			grant.Actions = append(grant.Actions, action)
+			for _, level := range c.accessLevels(action) {
+				levels[level] = true
+				if inEffect {
+					allLevels[level] = true
+				}
+			}
+		}
+		sort.Strings(grant.Actions)
+		grant.AccessLevels = sortAccessLevels(levels)
+		grants = append(grants, grant)
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Principal == grants[j].Principal {
+			return grants[i].Window < grants[j].Window
+		}
+		return grants[i].Principal < grants[j].Principal
+	})
+	return grants, sortAccessLevels(allLevels)
+}
@@ -0,0 +1,131 @@
+package report
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+// testCatalog is a small subset of catalog/actions.json
+var testCatalog = actionCatalog{
+	"s3": {
+		"GetObject":    AccessLevelRead,
+		"ListBucket":   AccessLevelList,
+		"PutObject":    AccessLevelWrite,
+		"PutBucketAcl": AccessLevelPermissionsManagement,
+	},
+	"sts": {
+		"AssumeRole":                AccessLevelWrite,
+		"AssumeRoleWithWebIdentity": AccessLevelWrite,
+		"TagSession":                AccessLevelTagging,
+	},
+}
+
+func TestActionCatalogExpand(t *testing.T) {
+	tests := []struct {
+		service  string
+		pattern  string
+		expected []string
+	}{
+		{"s3", "s3:GetObject", []string{"s3:GetObject"}},
+		{"s3", "s3:put*", []string{"s3:PutBucketAcl", "s3:PutObject"}},
+		{"s3", "*", []string{"s3:GetObject", "s3:ListBucket", "s3:PutBucketAcl", "s3:PutObject"}},
+		{"s3", "s3:DoesNotExist", []string{"s3:DoesNotExist"}},
+		{"s3", "sqs:SendMessage", []string{"sqs:SendMessage"}},
+		{"iam", "*", []string{"sts:AssumeRole", "sts:AssumeRoleWithWebIdentity", "sts:TagSession"}},
+		{"s3control", "*", []string{"s3:GetObject", "s3:ListBucket", "s3:PutBucketAcl", "s3:PutObject"}},
+	}
+	for _, test := range tests {
+		t.Run(test.service+" "+test.pattern, func(t *testing.T) {
+			actions := testCatalog.expand(test.service, test.pattern)
+			sort.Strings(actions)
+			if !reflect.DeepEqual(actions, test.expected) {
+				t.Errorf("Unexpected actions %v, want %v", actions, test.expected)
+			}
+		})
+	}
+}
+
+func TestActionCatalogExpandNot(t *testing.T) {
+	tests := []struct {
+		service  string
+		excluded []string
+		expected []string
+	}{
+		{"s3", []string{"s3:Put*"}, []string{"s3:GetObject", "s3:ListBucket"}},
+		{"s3", []string{"s3:GetObject", "s3:ListBucket"}, []string{"s3:PutBucketAcl", "s3:PutObject"}},
+		{"sqs", []string{"sqs:SendMessage"}, []string{"sqs:*"}},
+	}
+	for _, test := range tests {
+		t.Run(test.service, func(t *testing.T) {
+			actions := testCatalog.expandNot(test.service, test.excluded)
+			sort.Strings(actions)
+			if !reflect.DeepEqual(actions, test.expected) {
+				t.Errorf("Unexpected actions %v, want %v", actions, test.expected)
+			}
+		})
+	}
+}
+
+func TestActionCatalogBuildGrants(t *testing.T) {
+	statementGrants := []policy.Grant{
+		{Principal: "333333333333", Actions: []string{"s3:GetObject"}},
+		{Principal: "333333333333", Actions: []string{"s3:List*"}},
+		{Principal: "444444444444", NotActions: []string{"s3:Get*", "s3:List*"}},
+		{Principal: "555555555555", Actions: []string{"s3:PutBucketAcl"}, Window: policy.TimeExpired},
+	}
+	grants, levels := testCatalog.buildGrants("s3", statementGrants)
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].Principal < grants[j].Principal
+	})
+	expected := []Grant{
+		{
+			Principal:    "333333333333",
+			Actions:      []string{"s3:GetObject", "s3:ListBucket"},
+			AccessLevels: []string{AccessLevelList, AccessLevelRead},
+		},
+		{
+			Principal:    "444444444444",
+			Actions:      []string{"s3:PutBucketAcl", "s3:PutObject"},
+			AccessLevels: []string{AccessLevelWrite, AccessLevelPermissionsManagement},
+		},
+		{
+			Principal:    "555555555555",
+			Actions:      []string{"s3:PutBucketAcl"},
+			AccessLevels: []string{AccessLevelPermissionsManagement},
+			Window:       policy.TimeExpired,
+		},
+	}
+	if !reflect.DeepEqual(grants, expected) {
+		t.Errorf("Unexpected grants\n got: %+v\nwant: %+v", grants, expected)
+	}
+	// the expired grant does not count towards the row's access levels
+	expectedLevels := []string{AccessLevelList, AccessLevelRead, AccessLevelWrite, AccessLevelPermissionsManagement}
+	if !reflect.DeepEqual(levels, expectedLevels) {
+		t.Errorf("Unexpected access levels %v, want %v", levels, expectedLevels)
+	}
+}
+
+func TestAccessLevels(t *testing.T) {
+	tests := []struct {
+		action   string
+		expected []string
+	}{
+		{"s3:getobject", []string{AccessLevelRead}},
+		{"sqs:ListQueues", []string{AccessLevelList}},
+		{"sqs:SetQueueAttributes", []string{AccessLevelWrite}},
+		{"sqs:GetQueuePolicy", []string{AccessLevelRead}},
+		{"sqs:AddPermission", []string{AccessLevelPermissionsManagement}},
+		{"sqs:*", accessLevelOrder},
+	}
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			levels := testCatalog.accessLevels(test.action)
+			if !reflect.DeepEqual(levels, test.expected) {
+				t.Errorf("Unexpected access levels %v, want %v", levels, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package report
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+// Findings for AWS Backup vault access policies
+const (
+	// an account outside the organization, or anyone, can copy recovery
+	// points into the vault
+	FindingBackupExternalCopy = "backup-external-copy"
+	// no Deny statement protects the vault's recovery points from deletion
+	FindingBackupMissingDenyDelete = "backup-missing-deny-delete"
+)
+
+// backupDeleteActions remove recovery points from a vault, either directly or
+// by shortening their retention
+var backupDeleteActions = []string{
+	"backup:DeleteRecoveryPoint",
+	"backup:UpdateRecoveryPointLifecycle",
+}
+
+// backupVaultFindings checks a Backup vault's access policy. Copying into a
+// vault is granted by the destination vault's policy, so external copy
+// access lets another account fill the vault with its recovery points.
+// Vaults meant for recovery should deny deleting recovery points to
+// everyone, so that a compromised account cannot remove them. The evidence
+// lists the statements granting external copy access, and the Deny
+// statements that only protect against some of the delete actions.
+func backupVaultFindings(p *policy.Policy, result *policy.Result, ctx *policy.Context) ([]string, []policy.Evidence) {
+	findings := []string{}
+	evidence := []policy.Evidence{}
+	copyStatements := map[int]bool{}
+	for _, grant := range result.Grants {
+		isExternal := grant.Principal == policy.Wildcard || !ctx.InOrg(grant.Principal)
+		isInEffect := grant.Window != policy.TimeExpired && grant.Window != policy.TimeFuture
+		if isExternal && isInEffect && grant.Principal != ctx.Account && !isServicePrincipal(grant.Principal) &&
+			grant.Allows("backup:CopyIntoBackupVault") {
+			copyStatements[grant.Statement] = true
+		}
+	}
+	if len(copyStatements) > 0 {
+		findings = append(findings, FindingBackupExternalCopy)
+		evidence = appendStatementEvidence(evidence, p, copyStatements)
+	}
+	denyStatements := map[int]bool{}
+	isMissingDeny := false
+	for _, action := range backupDeleteActions {
+		indexes := p.DenyingToAll(action)
+		if len(indexes) == 0 {
+			isMissingDeny = true
+		}
+		for _, index := range indexes {
+			denyStatements[index] = true
+		}
+	}
+	if isMissingDeny {
+		findings = append(findings, FindingBackupMissingDenyDelete)
+		evidence = appendStatementEvidence(evidence, p, denyStatements)
+	}
+	return findings, evidence
+}
+
+func appendStatementEvidence(evidence []policy.Evidence, p *policy.Policy, indexes map[int]bool) []policy.Evidence {
+	sorted := make([]int, 0, len(indexes))
+	for index := range indexes {
+		sorted = append(sorted, index)
+	}
+	sort.Ints(sorted)
+	for _, index := range sorted {
+		evidence = append(evidence, p.StatementEvidence(index))
+	}
+	return evidence
+}
+
+// runBackupVaultQuery returns a row for every Backup vault without an access
+// policy. Nothing denies deleting their recovery points.
+func runBackupVaultQuery(db *sql.DB) ([]Row, error) {
+	query, err := loadQuery("backup_vaults_without_policy")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load backup vaults query")
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "DB error analyzing backup vaults")
+	}
+	defer rows.Close()
+	results := []Row{}
+	for rows.Next() {
+		row := Row{
+			Service:      "backup",
+			ProviderType: "BackupVault",
+			PublicAccess: policy.NotPublic,
+			Findings:     findingsFromKinds([]string{FindingBackupMissingDenyDelete}),
+		}
+		err = rows.Scan(&row.Arn)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read backup vault row")
+		}
+		results = append(results, row)
+	}
+	return results, nil
+}
@@ -0,0 +1,96 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+func TestBackupVaultFindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		findings []string
+		// evidence lists the references of the statements cited
+		evidence []string
+	}{
+		{
+			name: "external copy and partial deny",
+			document: `{"Version": "2012-10-17", "Statement": [
+				{"Sid": "DenyDelete", "Effect": "Deny", "Principal": "*", "Action": "backup:DeleteRecoveryPoint", "Resource": "*"},
+				{"Sid": "VendorCopy", "Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::333333333333:root"},
+					"Action": "backup:CopyIntoBackupVault", "Resource": "*"}]}`,
+			findings: []string{FindingBackupExternalCopy, FindingBackupMissingDenyDelete},
+			evidence: []string{"Statement[1] (VendorCopy)", "Statement[0] (DenyDelete)"},
+		},
+		{
+			name: "in-org copy and full deny",
+			document: `{"Version": "2012-10-17", "Statement": [
+				{"Sid": "OrgCopy", "Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::222222222222:root"},
+					"Action": "backup:CopyIntoBackupVault", "Resource": "*"},
+				{"Sid": "DenyDelete", "Effect": "Deny", "Principal": {"AWS": "*"},
+					"Action": ["backup:DeleteRecoveryPoint", "backup:UpdateRecoveryPointLifecycle"], "Resource": "*"}]}`,
+		},
+		{
+			name: "expired external copy",
+			document: `{"Version": "2012-10-17", "Statement": [
+				{"Sid": "MigrationCopy", "Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::333333333333:root"},
+					"Action": "backup:CopyIntoBackupVault", "Resource": "*",
+					"Condition": {"DateLessThan": {"aws:CurrentTime": "2020-01-01T00:00:00Z"}}},
+				{"Sid": "DenyDelete", "Effect": "Deny", "Principal": "*", "Action": "backup:*", "Resource": "*"}]}`,
+		},
+		{
+			name: "no deny",
+			document: `{"Version": "2012-10-17", "Statement": [
+				{"Sid": "OrgCopy", "Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::222222222222:root"},
+					"Action": "backup:CopyIntoBackupVault", "Resource": "*"}]}`,
+			findings: []string{FindingBackupMissingDenyDelete},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := &policy.Context{
+				Account:      "111111111111",
+				Organization: "o-abc123def4",
+				OrgAccounts:  map[string]bool{"111111111111": true, "222222222222": true},
+				Now:          time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			}
+			p, err := policy.Parse([]byte(test.document))
+			if err != nil {
+				t.Fatalf("Failed to parse policy: %v", err)
+			}
+			findings, evidence := backupVaultFindings(p, policy.Evaluate(p, ctx), ctx)
+			if !equalStrings(findings, test.findings) {
+				t.Errorf("Unexpected findings %v, want %v", findings, test.findings)
+			}
+			references := []string{}
+			for _, e := range evidence {
+				references = append(references, e.Reference())
+			}
+			if !equalStrings(references, test.evidence) {
+				t.Errorf("Unexpected evidence %v, want %v", references, test.evidence)
+			}
+		})
+	}
+}
+
+func TestMergeEvidence(t *testing.T) {
+	evidence := []policy.Evidence{
+		{Index: 2, Document: "Policy"},
+		{Index: 0, Document: "Policy"},
+	}
+	extra := []policy.Evidence{
+		{Index: 0, Document: "Policy"},
+		{Index: 1, Document: "ACL"},
+	}
+	merged := mergeEvidence(evidence, extra)
+	references := []string{}
+	for _, e := range merged {
+		references = append(references, e.Reference())
+	}
+	expected := []string{"ACL Statement[1]", "Policy Statement[0]", "Policy Statement[2]"}
+	if !equalStrings(references, expected) {
+		t.Errorf("Unexpected evidence %v, want %v", references, expected)
+	}
+}
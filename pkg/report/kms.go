@@ -0,0 +1,192 @@
+package report
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+// MechanismKMSGrant is a KMS grant allowing a principal to use a key
+const MechanismKMSGrant = "KMS grant"
+
+// kmsGrant is a grant as returned by ListGrants
+type kmsGrant struct {
+	GrantID           string `json:"GrantId"`
+	Name              string
+	GranteePrincipal  string
+	RetiringPrincipal string
+	Operations        []string
+	Constraints       *struct {
+		EncryptionContextSubset map[string]string
+		EncryptionContextEquals map[string]string
+	}
+}
+
+// grantPrincipal classifies a grantee or retiring principal, which is an
+// account, an IAM ARN, or a service principal, as an account id, or a service
+// principal
+func grantPrincipal(principal string) (string, bool) {
+	if isServicePrincipal(principal) {
+		return principal, true
+	}
+	identity := policy.Identity{Type: policy.PrincipalAWS, ID: principal}
+	return identity.AccountID(), false
+}
+
+// constraints lists the grant's encryption context constraints, such as
+// EncryptionContextEquals aws:s3:arn=arn:aws:s3:::bucket
+func (g *kmsGrant) constraints() []string {
+	if g.Constraints == nil {
+		return nil
+	}
+	constraints := []string{}
+	for _, c := range []struct {
+		name    string
+		context map[string]string
+	}{
+		{"EncryptionContextEquals", g.Constraints.EncryptionContextEquals},
+		{"EncryptionContextSubset", g.Constraints.EncryptionContextSubset},
+	} {
+		for key, value := range c.context {
+			constraints = append(constraints, c.name+" "+key+"="+value)
+		}
+	}
+	sort.Strings(constraints)
+	return constraints
+}
+
+func (g *kmsGrant) describe() string {
+	name := g.GrantID
+	if g.Name != "" {
+		name = g.Name + " (" + g.GrantID + ")"
+	}
+	description := name + " allows " + g.GranteePrincipal + " " + strings.Join(g.Operations, ", ")
+	if g.RetiringPrincipal != "" {
+		description += ", retirable by " + g.RetiringPrincipal
+	}
+	if constraints := g.constraints(); len(constraints) > 0 {
+		description += ", constrained by " + strings.Join(constraints, ", ")
+	}
+	return description
+}
+
+// applyKMSGrants adds the access granted by KMS grants to the rows of their
+// keys, classifying grantees the same way as principals of the key policy.
+// Retiring principals are classified too, as they can call kms:RetireGrant.
+// Rows are added for keys only shared through grants. Grants to the scanned
+// account are listed as access controls, but grant no access of their own.
+func applyKMSGrants(db *sql.DB, ctx *policy.Context, catalog actionCatalog, rows []Row) ([]Row, error) {
+	query, err := loadQuery("kms_grants")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load kms grants query")
+	}
+	keyRows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "DB error analyzing kms grants")
+	}
+	defer keyRows.Close()
+	byArn := map[string]int{}
+	for i, row := range rows {
+		if row.Service == "kms" && row.ProviderType == "Key" {
+			byArn[row.Arn] = i
+		}
+	}
+	for keyRows.Next() {
+		var arn string
+		var grantsJSON []byte
+		err = keyRows.Scan(&arn, &grantsJSON)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read kms key row")
+		}
+		grants := []kmsGrant{}
+		err = json.Unmarshal(grantsJSON, &grants)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse grants for %v", arn)
+		}
+		index, hasRow := byArn[arn]
+		row := &Row{Arn: arn, Service: "kms", ProviderType: "Key", PublicAccess: policy.NotPublic}
+		if hasRow {
+			row = &rows[index]
+		}
+		inOrg := map[string]bool{}
+		for _, id := range row.InOrgAccounts {
+			inOrg[id] = true
+		}
+		external := map[string]bool{}
+		for _, id := range row.ExternalAccounts {
+			external[id] = true
+		}
+		services := map[string]bool{}
+		for _, service := range row.Services {
+			services[service] = true
+		}
+		allLevels := map[string]bool{}
+		for _, level := range row.AccessLevels {
+			allLevels[level] = true
+		}
+		// classify records a grantee or retiring principal, returning false
+		// for principals of the scanned account, which grant no access
+		classify := func(grantPrincipalID string) (string, bool) {
+			principal, isService := grantPrincipal(grantPrincipalID)
+			switch {
+			case isService:
+				services[principal] = true
+			case principal == "" || principal == ctx.Account:
+				return "", false
+			case ctx.InOrg(principal):
+				inOrg[principal] = true
+			default:
+				external[principal] = true
+			}
+			return principal, true
+		}
+		addGrant := func(principal string, actions []string, constraints []string) {
+			built, levels := catalog.buildGrants("kms", []policy.Grant{{Principal: principal, Actions: actions}})
+			for _, grant := range built {
+				grant.Constraints = constraints
+				row.Grants = append(row.Grants, grant)
+			}
+			for _, level := range levels {
+				allLevels[level] = true
+			}
+		}
+		hasGrants := false
+		for _, grant := range grants {
+			row.AccessControls = append(row.AccessControls, AccessControl{
+				Mechanism:   MechanismKMSGrant,
+				Description: grant.describe(),
+			})
+			if principal, ok := classify(grant.GranteePrincipal); ok {
+				actions := make([]string, len(grant.Operations))
+				for i, operation := range grant.Operations {
+					actions[i] = "kms:" + operation
+				}
+				addGrant(principal, actions, grant.constraints())
+				hasGrants = true
+			}
+			if grant.RetiringPrincipal == "" {
+				continue
+			}
+			if principal, ok := classify(grant.RetiringPrincipal); ok {
+				addGrant(principal, []string{"kms:RetireGrant"}, nil)
+				hasGrants = true
+			}
+		}
+		if !hasGrants && !hasRow {
+			continue
+		}
+		row.InOrgAccounts = sortedKeys(inOrg)
+		row.ExternalAccounts = sortedKeys(external)
+		row.Services = sortedKeys(services)
+		row.AccessLevels = sortAccessLevels(allLevels)
+		if !hasRow {
+			rows = append(rows, *row)
+		}
+	}
+	return rows, nil
+}
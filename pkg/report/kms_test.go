@@ -0,0 +1,67 @@
+package report
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGrantPrincipal(t *testing.T) {
+	tests := []struct {
+		principal string
+		expected  string
+		isService bool
+	}{
+		{"arn:aws:iam::333333333333:role/app", "333333333333", false},
+		{"arn:aws:sts::333333333333:assumed-role/app/session", "333333333333", false},
+		{"333333333333", "333333333333", false},
+		{"dynamodb.us-east-1.amazonaws.com", "dynamodb.us-east-1.amazonaws.com", true},
+	}
+	for _, test := range tests {
+		t.Run(test.principal, func(t *testing.T) {
+			principal, isService := grantPrincipal(test.principal)
+			if principal != test.expected || isService != test.isService {
+				t.Errorf("Unexpected principal %v (service %v), want %v (service %v)",
+					principal, isService, test.expected, test.isService)
+			}
+		})
+	}
+}
+
+func TestKMSGrantDescribe(t *testing.T) {
+	tests := []struct {
+		name        string
+		grant       string
+		constraints []string
+		description string
+	}{
+		{
+			name:        "unconstrained",
+			grant:       `{"GrantId": "g1", "GranteePrincipal": "arn:aws:iam::333333333333:role/app", "Operations": ["Decrypt"]}`,
+			description: "g1 allows arn:aws:iam::333333333333:role/app Decrypt",
+		},
+		{
+			name: "constrained and retirable",
+			grant: `{"GrantId": "g2", "Name": "backups", "GranteePrincipal": "333333333333",
+				"RetiringPrincipal": "arn:aws:iam::444444444444:root", "Operations": ["Encrypt", "Decrypt"],
+				"Constraints": {"EncryptionContextSubset": {"team": "data"}, "EncryptionContextEquals": {"aws:s3:arn": "arn:aws:s3:::b"}}}`,
+			constraints: []string{"EncryptionContextEquals aws:s3:arn=arn:aws:s3:::b", "EncryptionContextSubset team=data"},
+			description: "backups (g2) allows 333333333333 Encrypt, Decrypt, retirable by arn:aws:iam::444444444444:root, " +
+				"constrained by EncryptionContextEquals aws:s3:arn=arn:aws:s3:::b, EncryptionContextSubset team=data",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grant := &kmsGrant{}
+			err := json.Unmarshal([]byte(test.grant), grant)
+			if err != nil {
+				t.Fatalf("Failed to parse grant: %v", err)
+			}
+			if constraints := grant.constraints(); !equalStrings(constraints, test.constraints) {
+				t.Errorf("Unexpected constraints %v, want %v", constraints, test.constraints)
+			}
+			if description := grant.describe(); description != test.description {
+				t.Errorf("Unexpected description %q, want %q", description, test.description)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package report
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+// FindingPublicFunctionURL is reported for functions anyone can invoke over
+// HTTPS, without signing the request
+const FindingPublicFunctionURL = "public-function-url"
+
+// Auth types of a Lambda function URL
+const (
+	FunctionURLAuthNone = "NONE"
+	FunctionURLAuthIAM  = "AWS_IAM"
+)
+
+// FunctionURL is the configuration of a Lambda function URL
+type FunctionURL struct {
+	URL      string `json:"FunctionUrl"`
+	AuthType string
+	Cors     *struct {
+		AllowOrigins     []string
+		AllowMethods     []string
+		AllowCredentials bool
+	}
+}
+
+// CORS summarizes the origins and methods allowed by the URL's CORS
+// configuration
+func (f *FunctionURL) CORS() string {
+	if f.Cors == nil || len(f.Cors.AllowOrigins) == 0 {
+		return "none"
+	}
+	summary := "origins " + strings.Join(f.Cors.AllowOrigins, ", ")
+	if len(f.Cors.AllowMethods) > 0 {
+		summary += "; methods " + strings.Join(f.Cors.AllowMethods, ", ")
+	}
+	if f.Cors.AllowCredentials {
+		summary += "; with credentials"
+	}
+	return summary
+}
+
+// grantsPublicInvokeFunctionURL returns true if the row's policy allows
+// anyone to invoke the function through its URL. Expired and not yet active
+// grants are skipped.
+func (r *Row) grantsPublicInvokeFunctionURL() bool {
+	for _, grant := range r.Grants {
+		if grant.Principal != policy.Wildcard || !grant.inEffect() {
+			continue
+		}
+		for _, action := range grant.Actions {
+			if strings.EqualFold(action, "lambda:InvokeFunctionUrl") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyLambdaFunctionURLs records the function URL of each function with a
+// policy granting access. A URL with AuthType NONE whose function allows
+// lambda:InvokeFunctionUrl to everyone can be invoked by anyone over HTTPS.
+func applyLambdaFunctionURLs(db *sql.DB, rows []Row) error {
+	query, err := loadQuery("lambda_function_urls")
+	if err != nil {
+		return errors.Wrap(err, "Failed to load lambda function urls query")
+	}
+	urlRows, err := db.Query(query)
+	if err != nil {
+		return errors.Wrap(err, "DB error analyzing lambda function urls")
+	}
+	defer urlRows.Close()
+	byArn := map[string]*Row{}
+	for i := range rows {
+		if rows[i].Service == "lambda" && rows[i].ProviderType == "Function" {
+			byArn[rows[i].Arn] = &rows[i]
+		}
+	}
+	for urlRows.Next() {
+		var arn string
+		var configJSON []byte
+		err = urlRows.Scan(&arn, &configJSON)
+		if err != nil {
+			return errors.Wrap(err, "Failed to read lambda function url row")
+		}
+		row, ok := byArn[arn]
+		if !ok {
+			// without a policy granting access, the URL cannot be invoked
+			continue
+		}
+		functionURL := &FunctionURL{}
+		err = json.Unmarshal(configJSON, functionURL)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to parse function url config for %v", arn)
+		}
+		row.FunctionURL = functionURL
+		if functionURL.AuthType == FunctionURLAuthNone && row.grantsPublicInvokeFunctionURL() {
+			row.Findings = append(row.Findings, findingsFromKinds([]string{FindingPublicFunctionURL})...)
+		}
+	}
+	return nil
+}
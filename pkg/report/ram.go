@@ -0,0 +1,112 @@
+package report
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+// FindingRAMExternalSharing is reported for resource shares that allow
+// principals outside the organization
+const FindingRAMExternalSharing = "ram-external-sharing"
+
+// MechanismRAMShare is an AWS Resource Access Manager resource share
+const MechanismRAMShare = "RAM share"
+
+// organizationArnPattern matches the ARN of an organization or one of its
+// organizational units, capturing the organization id and OU id
+var organizationArnPattern = regexp.MustCompile(`^arn:aws[a-z-]*:organizations::[0-9]{12}:(?:organization|ou)/(o-[a-z0-9]+)(?:/(ou-[a-z0-9-]+))?$`)
+
+// classifyShareePrincipal adds a resource share principal to the row. Shares
+// can name accounts, IAM users and roles, service principals, or an
+// organization or OU, which is listed by its organization id.
+func classifyShareePrincipal(row *Row, ctx *policy.Context, principal string) {
+	id := principal
+	if match := organizationArnPattern.FindStringSubmatch(principal); match != nil {
+		id = match[1]
+		if match[2] != "" {
+			row.OrganizationalUnits = append(row.OrganizationalUnits, match[2])
+		}
+	} else if isServicePrincipal(principal) {
+		row.Services = append(row.Services, principal)
+		return
+	} else if strings.HasPrefix(principal, "arn:") {
+		id = policy.Identity{Type: policy.PrincipalAWS, ID: principal}.AccountID()
+	}
+	switch {
+	case id == "" || id == ctx.Account:
+		return
+	case ctx.InOrg(id):
+		row.InOrgAccounts = append(row.InOrgAccounts, id)
+	default:
+		row.ExternalAccounts = append(row.ExternalAccounts, id)
+	}
+}
+
+func uniqueSorted(values []string) []string {
+	set := map[string]bool{}
+	for _, value := range values {
+		set[value] = true
+	}
+	return sortedKeys(set)
+}
+
+// runRAMResourceShareQuery returns a row for every active resource share.
+// Older imports do not include resource shares, in which case none are
+// returned.
+func runRAMResourceShareQuery(db *sql.DB, ctx *policy.Context) ([]Row, error) {
+	exists, err := tableExists(db, "aws_ram_resourceshare")
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		log.Warn("RAM resource shares were not imported, skipping them")
+		return nil, nil
+	}
+	query, err := loadQuery("ram_resource_shares")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load ram resource shares query")
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "DB error analyzing ram resource shares")
+	}
+	defer rows.Close()
+	results := []Row{}
+	for rows.Next() {
+		row := Row{
+			Service:      "ram",
+			ProviderType: "ResourceShare",
+			PublicAccess: policy.NotPublic,
+		}
+		var allowExternal bool
+		var principals []string
+		err = rows.Scan(&row.Arn, &allowExternal, pq.Array(&principals), pq.Array(&row.LinkedResources))
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read ram resource share row")
+		}
+		for _, principal := range principals {
+			classifyShareePrincipal(&row, ctx, principal)
+		}
+		row.InOrgAccounts = uniqueSorted(row.InOrgAccounts)
+		row.ExternalAccounts = uniqueSorted(row.ExternalAccounts)
+		row.Services = uniqueSorted(row.Services)
+		row.OrganizationalUnits = uniqueSorted(row.OrganizationalUnits)
+		description := "external principals not allowed"
+		if allowExternal {
+			description = "allows external principals"
+			row.Findings = findingsFromKinds([]string{FindingRAMExternalSharing})
+		}
+		row.AccessControls = append(row.AccessControls, AccessControl{
+			Mechanism:   MechanismRAMShare,
+			Description: description,
+		})
+		results = append(results, row)
+	}
+	return results, nil
+}
@@ -0,0 +1,53 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+func TestClassifyShareePrincipal(t *testing.T) {
+	tests := []struct {
+		principal           string
+		inOrgAccounts       []string
+		externalAccounts    []string
+		services            []string
+		organizationalUnits []string
+	}{
+		{principal: "222222222222", inOrgAccounts: []string{"222222222222"}},
+		{principal: "333333333333", externalAccounts: []string{"333333333333"}},
+		{principal: "111111111111"},
+		{principal: "arn:aws:iam::333333333333:role/app", externalAccounts: []string{"333333333333"}},
+		{principal: "arn:aws:organizations::111111111111:organization/o-abc123def4", inOrgAccounts: []string{"o-abc123def4"}},
+		{
+			principal:           "arn:aws:organizations::111111111111:ou/o-abc123def4/ou-ab12-cdef3456",
+			inOrgAccounts:       []string{"o-abc123def4"},
+			organizationalUnits: []string{"ou-ab12-cdef3456"},
+		},
+		{principal: "arn:aws:organizations::999999999999:organization/o-zzzzzzzzzz", externalAccounts: []string{"o-zzzzzzzzzz"}},
+		{principal: "ec2.amazonaws.com", services: []string{"ec2.amazonaws.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.principal, func(t *testing.T) {
+			ctx := &policy.Context{
+				Account:      "111111111111",
+				Organization: "o-abc123def4",
+				OrgAccounts:  map[string]bool{"111111111111": true, "222222222222": true},
+			}
+			row := &Row{}
+			classifyShareePrincipal(row, ctx, test.principal)
+			if !equalStrings(row.InOrgAccounts, test.inOrgAccounts) {
+				t.Errorf("Unexpected in-org accounts %v, want %v", row.InOrgAccounts, test.inOrgAccounts)
+			}
+			if !equalStrings(row.ExternalAccounts, test.externalAccounts) {
+				t.Errorf("Unexpected external accounts %v, want %v", row.ExternalAccounts, test.externalAccounts)
+			}
+			if !equalStrings(row.Services, test.services) {
+				t.Errorf("Unexpected services %v, want %v", row.Services, test.services)
+			}
+			if !equalStrings(row.OrganizationalUnits, test.organizationalUnits) {
+				t.Errorf("Unexpected organizational units %v, want %v", row.OrganizationalUnits, test.organizationalUnits)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package report
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"sort"
 	"strings"
@@ -12,6 +14,8 @@ import (
 	"github.com/pkg/errors"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
 )
 
 type Row struct {
@@ -20,21 +24,113 @@ type Row struct {
 	ProviderType     string
 	InOrgAccounts    []string
 	ExternalAccounts []string
-	IsPublic         bool
+	PublicAccess     policy.PublicAccess
+	// UnevaluatedConditionKeys lists the condition keys rpCheckup could not
+	// reason about on conditionally public grants
+	UnevaluatedConditionKeys []string
+	// NetworkRestrictions lists the CIDRs, VPCs and VPC endpoints from which
+	// anyone can access the resource
+	NetworkRestrictions []string
+	// Services lists the AWS service principals, such as sns.amazonaws.com,
+	// that are granted access
+	Services []string
+	// NarrowedByDeny is set when a Deny statement removed or narrowed
+	// access granted by one of the policy's Allow statements
+	NarrowedByDeny bool
+	Findings       []Finding
+	// OrganizationalUnits lists the ids of the organizational units a
+	// snapshot or image is shared with. Their organization is listed with
+	// the In-Org or External accounts.
+	OrganizationalUnits []string
+	// OrphanedPrincipals lists the unique ids, such as AIDA... or AROA...,
+	// of deleted IAM identities named in the policy
+	OrphanedPrincipals []string
+	// Grants lists the actions allowed to each principal with access
+	Grants []Grant
+	// AccessLevels classifies the actions allowed across all Grants
+	AccessLevels []string
+	// Evidence lists the policy statements responsible for this Row's
+	// access and findings
+	Evidence []policy.Evidence
+	// FunctionURL is the function URL of a Lambda function, if it has one
+	FunctionURL *FunctionURL
+	// LinkedResources lists the ARNs of related resources, such as the
+	// buckets behind an S3 access point, or a bucket's access points
+	LinkedResources []string
+	// AccessControls lists the mechanisms, such as S3 ACLs and Block Public
+	// Access, that grant or block access alongside the resource policy
+	AccessControls []AccessControl
+}
+
+// Finding describes a risky construct or pattern detected in the
+// policy attached to a resource
+type Finding struct {
+	Kind        string
+	Description string
+}
+
+var findingDescriptions = map[string]string{
+	policy.FindingAllowNotPrincipal:     "Allow with NotPrincipal grants access to everyone not listed",
+	policy.FindingAllowNotAction:        "Allow with NotAction grants every action not listed",
+	policy.FindingBroadNetworkCondition: "Network condition is too broad to restrict access, treated as public",
+	policy.FindingExpiredGrant: "Statement's date conditions expired before the snapshot, " +
+		"it grants nothing and can be removed",
+	policy.FindingFutureGrant: "Statement's date conditions only take effect after the snapshot",
+	policy.FindingUnrestrictedWebIdentity: "OIDC identity provider trusted without restricting the token's sub, " +
+		"anyone using the provider can assume the role",
+	policy.FindingMissingExternalID: "External account can assume the role without an sts:ExternalId " +
+		"or MFA condition",
+	FindingBackupExternalCopy:      "Account outside the organization can copy recovery points into the vault",
+	FindingBackupMissingDenyDelete: "No Deny statement protects recovery points from deletion by every principal",
+	FindingRAMExternalSharing:      "Resource share allows principals outside the organization",
+	FindingPublicFunctionURL:       "Function URL with AuthType NONE can be invoked by anyone over HTTPS",
+	policy.FindingOrphanedPrincipal: "Principal is the unique id of a deleted IAM user or role, " +
+		"the statement can be removed",
+	policy.FindingIneffectiveCondition: "IfExists or ForAllValues makes a condition restricting access match " +
+		"requests without the condition key",
+	policy.FindingServiceConfusedDeputy: "Service principal granted access without an aws:SourceAccount, " +
+		"aws:SourceArn or aws:SourceOrgID condition",
+}
+
+func findingsFromKinds(kinds []string) []Finding {
+	findings := make([]Finding, 0, len(kinds))
+	for _, kind := range kinds {
+		description, ok := findingDescriptions[kind]
+		if !ok {
+			description = kind
+		}
+		findings = append(findings, Finding{Kind: kind, Description: description})
+	}
+	return findings
+}
+
+// IsPublic returns true if anyone can access the resource, whether or not
+// conditions apply
+func (r *Row) IsPublic() bool {
+	return r.PublicAccess == policy.UnconditionallyPublic || r.PublicAccess == policy.ConditionallyPublic
 }
 
 // Access returns a human-readable string describing who can
 // access the resource associated with this Row
 func (r *Row) Access() string {
-	if r.IsPublic {
+	if r.PublicAccess == policy.UnconditionallyPublic {
 		return "Public"
 	}
+	if r.PublicAccess == policy.ConditionallyPublic {
+		return "Conditionally Public"
+	}
+	if len(r.NetworkRestrictions) > 0 {
+		return "Network-Restricted"
+	}
 	if len(r.ExternalAccounts) > 0 {
 		return "External Accounts"
 	}
 	if len(r.InOrgAccounts) > 0 {
 		return "In-Org Accounts"
 	}
+	if len(r.Services) > 0 {
+		return "AWS Services"
+	}
 	return "Private"
 }
 
@@ -45,6 +141,13 @@ type Metadata struct {
 	Generated    time.Time
 	Account      string
 	Organization string
+	// UnparsedStatements counts policy statements that could not be
+	// parsed, or whose principal could not be classified, and so are not
+	// reflected in any Row
+	UnparsedStatements int
+	// UnparsedPolicies counts policy documents that could not be parsed at
+	// all, so their statements could not be counted
+	UnparsedPolicies int
 }
 
 type Report struct {
@@ -72,30 +175,77 @@ func Generate(connectionString string) (*Report, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to load metadata")
 	}
-	rows, err := runResourceAccessQuery(db, metadata.Account)
+	ctx, err := loadEvaluationContext(db, metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load organization accounts")
+	}
+	catalog, err := loadActionCatalog()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load IAM action catalog")
+	}
+	rows, accessPointDelegations, err := runResourceAccessQuery(db, ctx, catalog, metadata)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to run analysis query")
 	}
-	volumeSnapshotsRows, err := runEC2SnapshotQuery(db, metadata.Account)
+	rows, err = applyS3BucketAccess(db, ctx, rows, accessPointDelegations)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to run s3 bucket access query")
+	}
+	rows, err = linkS3AccessPoints(db, rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to link s3 access points")
+	}
+	rows, err = applyKMSGrants(db, ctx, catalog, rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to run kms grants query")
+	}
+	err = applyLambdaFunctionURLs(db, rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to run lambda function urls query")
+	}
+	if metadata.UnparsedStatements > 0 {
+		log.Warnf("%v policy statements could not be parsed", metadata.UnparsedStatements)
+	}
+	if metadata.UnparsedPolicies > 0 {
+		log.Warnf("%v policies could not be parsed", metadata.UnparsedPolicies)
+	}
+	volumeSnapshotsRows, err := runEC2SnapshotQuery(db, ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to run snapshot query")
 	}
 	rows = append(rows, volumeSnapshotsRows...)
-	imageRows, err := runEC2ImageQuery(db, metadata.Account)
+	imageRows, err := runEC2ImageQuery(db, ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to run snapshot query")
 	}
 	rows = append(rows, imageRows...)
-	dbSnapshotsRows, err := runRDSDBSnapshotQuery(db, metadata.Account)
+	dbSnapshotsRows, err := runRDSDBSnapshotQuery(db, ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to run snapshot query")
 	}
 	rows = append(rows, dbSnapshotsRows...)
-	dbClusterSnapshotsRows, err := runRDSDBClusterSnapshotQuery(db, metadata.Account)
+	for _, service := range []string{"rds", "docdb", "neptune"} {
+		dbClusterSnapshotsRows, err := runDBClusterSnapshotQuery(db, service, ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to run snapshot query")
+		}
+		rows = append(rows, dbClusterSnapshotsRows...)
+	}
+	redshiftSnapshotsRows, err := runRedshiftSnapshotQuery(db, ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to run snapshot query")
 	}
-	rows = append(rows, dbClusterSnapshotsRows...)
+	rows = append(rows, redshiftSnapshotsRows...)
+	backupVaultRows, err := runBackupVaultQuery(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to run backup vault query")
+	}
+	rows = append(rows, backupVaultRows...)
+	resourceShareRows, err := runRAMResourceShareQuery(db, ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to run resource share query")
+	}
+	rows = append(rows, resourceShareRows...)
 	sort.SliceStable(rows, func(i, j int) bool {
 		return sortRowsLess(&rows[i], &rows[j])
 	})
@@ -106,10 +256,13 @@ func Generate(connectionString string) (*Report, error) {
 }
 
 var statusIndex map[string]int = map[string]int{
-	"Public":            0,
-	"External Accounts": 1,
-	"In-Org Accounts":   2,
-	"Private":           3,
+	"Public":               0,
+	"Conditionally Public": 1,
+	"Network-Restricted":   2,
+	"External Accounts":    3,
+	"In-Org Accounts":      4,
+	"AWS Services":         5,
+	"Private":              6,
 }
 
 func arnRegion(arn string) string {
@@ -152,6 +305,33 @@ func loadMetadata(db *sql.DB) (*Metadata, error) {
 	}, nil
 }
 
+func loadEvaluationContext(db *sql.DB, metadata *Metadata) (*policy.Context, error) {
+	query, err := loadQuery("organization_accounts")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load query")
+	}
+	queryRows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to query for organization accounts")
+	}
+	defer queryRows.Close()
+	orgAccounts := map[string]bool{}
+	for queryRows.Next() {
+		var accountID string
+		err = queryRows.Scan(&accountID)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read organization account row")
+		}
+		orgAccounts[accountID] = true
+	}
+	return &policy.Context{
+		Account:      metadata.Account,
+		Organization: metadata.Organization,
+		OrgAccounts:  orgAccounts,
+		Now:          metadata.Imported,
+	}, nil
+}
+
 // Sort by status first, then region, then name
 func sortRowsLess(a, b *Row) bool {
 	if a.Access() == b.Access() {
@@ -174,37 +354,168 @@ func installDbFunctions(db *sql.DB) error {
 	return nil
 }
 
-func runResourceAccessQuery(db *sql.DB, accountID string) ([]Row, error) {
-	analysisQuery, err := loadQuery("resource_policy_exposure")
+// parseResourcePolicies combines every policy document attached to a
+// resource into a single policy. When there are several, each statement
+// records which document it came from, such as Policy[1].
+func parseResourcePolicies(documents []json.RawMessage) (*policy.Policy, error) {
+	combined := &policy.Policy{}
+	for i, document := range documents {
+		p, err := policy.Parse(document)
+		if err != nil {
+			return nil, err
+		}
+		if len(documents) > 1 {
+			for j := range p.Statement {
+				p.Statement[j].Document = fmt.Sprintf("Policy[%v]", i)
+			}
+		}
+		combined.Statement = append(combined.Statement, p.Statement...)
+		combined.DroppedStatements += p.DroppedStatements
+	}
+	return combined, nil
+}
+
+// runResourceAccessQuery evaluates every imported resource policy. Along
+// with the rows of resources that grant access, it returns the accounts
+// whose S3 access points each bucket policy delegates access control to,
+// keyed by ARN, which are recorded even when the bucket grants no access
+// of its own.
+func runResourceAccessQuery(db *sql.DB, ctx *policy.Context, catalog actionCatalog, metadata *Metadata) ([]Row, map[string][]string, error) {
+	policiesQuery, err := loadQuery("resource_policies")
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to to load analysis query")
+		return nil, nil, errors.Wrap(err, "Failed to to load resource policies query")
 	}
-	rows, err := db.Query(analysisQuery, accountID)
+	rows, err := db.Query(policiesQuery)
 	if err != nil {
-		return nil, errors.Wrap(err, "DB error analyzing")
+		return nil, nil, errors.Wrap(err, "DB error loading resource policies")
 	}
 	defer rows.Close()
 	results := make([]Row, 0)
+	delegations := map[string][]string{}
 	for rows.Next() {
 		row := Row{}
-		err = rows.Scan(&row.Arn, &row.Service, &row.ProviderType,
-			pq.Array(&row.InOrgAccounts), pq.Array(&row.ExternalAccounts),
-			&row.IsPublic)
+		var policiesJSON []byte
+		err = rows.Scan(&row.Arn, &row.Service, &row.ProviderType, &policiesJSON)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Failed to unmarshal a row")
+		}
+		documents := []json.RawMessage{}
+		err = json.Unmarshal(policiesJSON, &documents)
 		if err != nil {
-			return nil, errors.Wrap(err, "Failed to unmarshal a row")
+			return nil, nil, errors.Wrapf(err, "Failed to read policies for %v", row.Arn)
 		}
+		p, err := parseResourcePolicies(documents)
+		if err != nil {
+			log.Warnf("Skipping unparseable policy for %v: %v", row.Arn, err)
+			metadata.UnparsedPolicies++
+			continue
+		}
+		if p.DroppedStatements > 0 {
+			log.Warnf("Skipping %v unparseable statements in the policy for %v", p.DroppedStatements, row.Arn)
+		}
+		result := policy.Evaluate(p, ctx)
+		metadata.UnparsedStatements += result.UnparsedStatements + p.DroppedStatements
+		// Service specific findings keep the row even without access, as a
+		// vault policy that grants nothing can still lack protections
+		var serviceFindings []string
+		var serviceEvidence []policy.Evidence
+		switch row.Service {
+		case "iam":
+			serviceFindings = policy.RoleTrustFindings(p, result, ctx)
+		case "backup":
+			serviceFindings, serviceEvidence = backupVaultFindings(p, result, ctx)
+		}
+		result.Findings = append(result.Findings, serviceFindings...)
+		result.Evidence = mergeEvidence(result.Evidence, serviceEvidence)
+		if len(result.AccessPointAccounts) > 0 {
+			delegations[row.Arn] = result.AccessPointAccounts
+		}
+		if !result.HasAccess && len(serviceFindings) == 0 {
+			continue
+		}
+		row.PublicAccess = result.PublicAccess
+		row.UnevaluatedConditionKeys = result.UnevaluatedConditionKeys
+		row.NetworkRestrictions = result.NetworkRestrictions
+		row.InOrgAccounts = result.InOrgAccounts
+		row.ExternalAccounts = result.ExternalAccounts
+		row.Services = result.Services
+		row.NarrowedByDeny = result.NarrowedByDeny
+		row.Findings = findingsFromKinds(result.Findings)
+		row.OrphanedPrincipals = result.OrphanedPrincipals
+		row.Grants, row.AccessLevels = catalog.buildGrants(row.Service, result.Grants)
+		row.Evidence = result.Evidence
 		results = append(results, row)
 	}
 	log.Debugf("%v result rows", len(results))
-	return results, nil
+	return results, delegations, nil
+}
+
+// mergeEvidence adds the statements in extra that are not already in
+// evidence, keeping them in policy order
+func mergeEvidence(evidence []policy.Evidence, extra []policy.Evidence) []policy.Evidence {
+	seen := map[string]bool{}
+	for _, e := range evidence {
+		seen[e.Reference()] = true
+	}
+	for _, e := range extra {
+		if !seen[e.Reference()] {
+			seen[e.Reference()] = true
+			evidence = append(evidence, e)
+		}
+	}
+	sort.SliceStable(evidence, func(i, j int) bool {
+		if evidence[i].Document != evidence[j].Document {
+			return evidence[i].Document < evidence[j].Document
+		}
+		return evidence[i].Index < evidence[j].Index
+	})
+	return evidence
+}
+
+// classifySharedOrganizations moves organization ids, which snapshots and
+// images can be shared with, from the external accounts to the in-org
+// accounts when they match the scanned organization
+func classifySharedOrganizations(row *Row, ctx *policy.Context) {
+	inOrg := map[string]bool{}
+	external := map[string]bool{}
+	for _, id := range row.InOrgAccounts {
+		inOrg[id] = true
+	}
+	for _, id := range row.ExternalAccounts {
+		if policy.IsOrgID(id) && ctx.InOrg(id) {
+			inOrg[id] = true
+		} else {
+			external[id] = true
+		}
+	}
+	row.InOrgAccounts = sortedKeys(inOrg)
+	row.ExternalAccounts = sortedKeys(external)
+}
+
+// isServicePrincipal returns true for AWS service principals, such as
+// sns.amazonaws.com
+func isServicePrincipal(principal string) bool {
+	return strings.HasSuffix(principal, ".amazonaws.com")
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-func runSnapshotQuery(db *sql.DB, queryName string, service string, resource string, accountID string) ([]Row, error) {
+// runSnapshotQuery runs a query returning the accounts snapshots or images
+// are shared with. The query is passed the scanned account, followed by any
+// args.
+func runSnapshotQuery(db *sql.DB, queryName string, service string, resource string, ctx *policy.Context, args ...interface{}) ([]Row, error) {
 	snapshotQuery, err := loadQuery(queryName)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to load %v %v query", service, resource)
 	}
-	rows, err := db.Query(snapshotQuery, accountID)
+	rows, err := db.Query(snapshotQuery, append([]interface{}{ctx.Account}, args...)...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "DB error analyzing %v %vs", service, resource)
 	}
@@ -214,33 +525,70 @@ func runSnapshotQuery(db *sql.DB, queryName string, service string, resource str
 		row := Row{
 			Service:      service,
 			ProviderType: resource,
+			PublicAccess: policy.NotPublic,
 		}
-		err = rows.Scan(&row.Arn, &row.IsPublic, pq.Array(&row.InOrgAccounts),
-			pq.Array(&row.ExternalAccounts))
+		var isPublic bool
+		err = rows.Scan(&row.Arn, &isPublic, pq.Array(&row.InOrgAccounts),
+			pq.Array(&row.ExternalAccounts), pq.Array(&row.OrganizationalUnits))
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to unmarshall a row")
 		}
+		classifySharedOrganizations(&row, ctx)
+		if isPublic {
+			row.PublicAccess = policy.UnconditionallyPublic
+		}
 		results = append(results, row)
 	}
 	return results, nil
 }
 
-func runEC2SnapshotQuery(db *sql.DB, accountID string) ([]Row, error) {
-	return runSnapshotQuery(db, "public_ec2_snapshots", "ec2", "Snapshot", accountID)
+func runEC2SnapshotQuery(db *sql.DB, ctx *policy.Context) ([]Row, error) {
+	return runSnapshotQuery(db, "public_ec2_snapshots", "ec2", "Snapshot", ctx)
 }
 
-func runEC2ImageQuery(db *sql.DB, accountID string) ([]Row, error) {
-	return runSnapshotQuery(db, "public_ec2_images", "ec2", "Image", accountID)
+func runEC2ImageQuery(db *sql.DB, ctx *policy.Context) ([]Row, error) {
+	return runSnapshotQuery(db, "public_ec2_images", "ec2", "Image", ctx)
 }
 
-func runRDSDBClusterSnapshotQuery(db *sql.DB, accountID string) ([]Row, error) {
-	return runSnapshotQuery(db, "public_rds_cluster_snapshots", "rds", "DBClusterSnapshot", accountID)
+func runRDSDBSnapshotQuery(db *sql.DB, ctx *policy.Context) ([]Row, error) {
+	return runSnapshotQuery(db, "public_rds_snapshots", "rds", "DBSnapshot", ctx)
 }
 
-func runRDSDBSnapshotQuery(db *sql.DB, accountID string) ([]Row, error) {
-	return runSnapshotQuery(db, "public_rds_snapshots", "rds", "DBSnapshot", accountID)
+// runDBClusterSnapshotQuery returns the cluster snapshots of service, which
+// is one of rds, docdb or neptune. DocumentDB and Neptune cluster snapshots
+// are managed through the RDS API, and are told apart from RDS cluster
+// snapshots by their engine.
+func runDBClusterSnapshotQuery(db *sql.DB, service string, ctx *policy.Context) ([]Row, error) {
+	return runSnapshotQuery(db, "public_rds_cluster_snapshots", service, "DBClusterSnapshot", ctx, service)
+}
+
+// runRedshiftSnapshotQuery returns the shared Redshift snapshots. Older
+// imports do not include Redshift, in which case none are returned.
+func runRedshiftSnapshotQuery(db *sql.DB, ctx *policy.Context) ([]Row, error) {
+	exists, err := tableExists(db, "aws_redshift_snapshot")
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		log.Warn("Redshift snapshots were not imported, skipping them")
+		return nil, nil
+	}
+	return runSnapshotQuery(db, "public_redshift_snapshots", "redshift", "Snapshot", ctx)
+}
+
+// tableExists returns true if the import includes the table. Tables for
+// resources the introspector added support for later are missing from older
+// imports.
+func tableExists(db *sql.DB, table string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists)
+	if err != nil {
+		return false, errors.Wrapf(err, "DB error checking for table %v", table)
+	}
+	return exists, nil
 }
 
+// loadQuery loads a bundled query. Queries read columns that older imports
+// may lack through to_jsonb, so that they are NULL rather than an error.
 func loadQuery(name string) (string, error) {
 	filename := "/queries/" + name + ".sql"
 	f, err := pkger.Open(filename)
@@ -0,0 +1,414 @@
+package report
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+// Mechanisms that grant or block access to an S3 bucket
+const (
+	MechanismBucketPolicy             = "Bucket policy"
+	MechanismACL                      = "ACL"
+	MechanismAccountBlockPublicAccess = "Account Block Public Access"
+	MechanismBucketBlockPublicAccess  = "Bucket Block Public Access"
+)
+
+// AccessControl describes how one mechanism, such as a bucket ACL, affects
+// access to a resource
+type AccessControl struct {
+	Mechanism string
+	// Blocks is set if the mechanism removes access granted by another
+	Blocks      bool
+	Description string
+}
+
+// ACL grantee groups, identified by URI
+const (
+	aclAllUsers           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	aclAuthenticatedUsers = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+	aclLogDelivery        = "http://acs.amazonaws.com/groups/s3/LogDelivery"
+)
+
+// aclPermissionLevels maps ACL permissions to the access levels of the
+// actions they allow
+var aclPermissionLevels = map[string][]string{
+	"READ":         {AccessLevelList},
+	"WRITE":        {AccessLevelWrite},
+	"READ_ACP":     {AccessLevelRead},
+	"WRITE_ACP":    {AccessLevelPermissionsManagement},
+	"FULL_CONTROL": {AccessLevelList, AccessLevelRead, AccessLevelWrite, AccessLevelPermissionsManagement},
+}
+
+type bucketACL struct {
+	Owner struct {
+		ID string
+	}
+	Grants []struct {
+		Grantee struct {
+			Type string
+			ID   string
+			URI  string
+		}
+		Permission string
+	}
+}
+
+// blockPublicAccess is a PublicAccessBlockConfiguration, either for the
+// account or a single bucket
+type blockPublicAccess struct {
+	BlockPublicAcls       bool
+	IgnorePublicAcls      bool
+	BlockPublicPolicy     bool
+	RestrictPublicBuckets bool
+}
+
+// settings lists the enabled settings, by name
+func (b *blockPublicAccess) settings() []string {
+	settings := []string{}
+	if b.BlockPublicAcls {
+		settings = append(settings, "BlockPublicAcls")
+	}
+	if b.IgnorePublicAcls {
+		settings = append(settings, "IgnorePublicAcls")
+	}
+	if b.BlockPublicPolicy {
+		settings = append(settings, "BlockPublicPolicy")
+	}
+	if b.RestrictPublicBuckets {
+		settings = append(settings, "RestrictPublicBuckets")
+	}
+	return settings
+}
+
+func parseBlockPublicAccess(raw []byte) (*blockPublicAccess, error) {
+	config := &blockPublicAccess{}
+	if len(raw) == 0 {
+		return config, nil
+	}
+	err := json.Unmarshal(raw, config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// loadAccountBlockPublicAccess returns the scanned account's Block Public
+// Access configuration. Older imports do not include it, in which case
+// none is assumed.
+func loadAccountBlockPublicAccess(db *sql.DB, accountID string) (*blockPublicAccess, error) {
+	none := &blockPublicAccess{}
+	exists, err := tableExists(db, "aws_s3control_accountpublicaccessblock")
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		log.Warn("Account Block Public Access settings were not imported, assuming none")
+		return none, nil
+	}
+	query, err := loadQuery("s3_account_public_access_block")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load account Block Public Access query")
+	}
+	var raw []byte
+	err = db.QueryRow(query, accountID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return none, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "DB error loading account Block Public Access settings")
+	}
+	config, err := parseBlockPublicAccess(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse account Block Public Access settings")
+	}
+	return config, nil
+}
+
+// applyBucketACL adds the access granted by a bucket's ACL to its row.
+// Grants to AllUsers and AuthenticatedUsers make the bucket public, unless
+// IgnorePublicAcls is set. Grants to other canonical users are listed as
+// external. The bucket owner's own grants are skipped.
+func applyBucketACL(row *Row, acl *bucketACL, ignorePublicAcls bool, blockedBy string) {
+	external := map[string]bool{}
+	for _, id := range row.ExternalAccounts {
+		external[id] = true
+	}
+	services := map[string]bool{}
+	for _, service := range row.Services {
+		services[service] = true
+	}
+	levels := map[string]bool{}
+	for _, level := range row.AccessLevels {
+		levels[level] = true
+	}
+	publicGrantees := []string{}
+	for _, grant := range acl.Grants {
+		var principal string
+		switch {
+		case grant.Grantee.URI == aclAllUsers || grant.Grantee.URI == aclAuthenticatedUsers:
+			name := grant.Grantee.URI[strings.LastIndex(grant.Grantee.URI, "/")+1:]
+			publicGrantees = append(publicGrantees, name+" ("+grant.Permission+")")
+			if ignorePublicAcls {
+				continue
+			}
+			principal = policy.Wildcard
+			row.PublicAccess = policy.UnconditionallyPublic
+		case grant.Grantee.URI == aclLogDelivery:
+			principal = "logging.s3.amazonaws.com"
+			services[principal] = true
+		case grant.Grantee.Type == "CanonicalUser" && grant.Grantee.ID != acl.Owner.ID:
+			principal = "canonical-user:" + grant.Grantee.ID
+			external[principal] = true
+			row.AccessControls = append(row.AccessControls, AccessControl{
+				Mechanism:   MechanismACL,
+				Description: "grants " + grant.Permission + " to canonical user " + grant.Grantee.ID,
+			})
+		default:
+			continue
+		}
+		grantLevels := aclPermissionLevels[grant.Permission]
+		for _, level := range grantLevels {
+			levels[level] = true
+		}
+		row.Grants = append(row.Grants, Grant{
+			Principal:    principal,
+			Actions:      []string{grant.Permission + " (ACL)"},
+			AccessLevels: grantLevels,
+		})
+	}
+	if len(publicGrantees) > 0 {
+		description := "grants " + strings.Join(publicGrantees, ", ")
+		if ignorePublicAcls {
+			description += ", ignored"
+		}
+		row.AccessControls = append(row.AccessControls, AccessControl{
+			Mechanism:   MechanismACL,
+			Description: description,
+		})
+		if ignorePublicAcls {
+			row.AccessControls = append(row.AccessControls, AccessControl{
+				Mechanism:   blockedBy,
+				Blocks:      true,
+				Description: "IgnorePublicAcls ignores public ACL grants",
+			})
+		}
+	}
+	row.ExternalAccounts = sortedKeys(external)
+	row.Services = sortedKeys(services)
+	row.AccessLevels = sortAccessLevels(levels)
+}
+
+// applyRestrictPublicBuckets removes the access granted by a public bucket
+// policy. With RestrictPublicBuckets set, only service principals and the
+// bucket owner's account can use a public policy.
+func applyRestrictPublicBuckets(row *Row, blockedBy string) {
+	row.AccessControls = append(row.AccessControls, AccessControl{
+		Mechanism:   blockedBy,
+		Blocks:      true,
+		Description: "RestrictPublicBuckets limits the public policy to service principals and the bucket owner",
+	})
+	row.PublicAccess = policy.NotPublic
+	row.UnevaluatedConditionKeys = nil
+	row.NetworkRestrictions = nil
+	row.InOrgAccounts = nil
+	row.ExternalAccounts = nil
+	grants := []Grant{}
+	levels := map[string]bool{}
+	for _, grant := range row.Grants {
+		if !isServicePrincipal(grant.Principal) {
+			continue
+		}
+		grants = append(grants, grant)
+		if grant.inEffect() {
+			for _, level := range grant.AccessLevels {
+				levels[level] = true
+			}
+		}
+	}
+	row.Grants = grants
+	row.AccessLevels = sortAccessLevels(levels)
+}
+
+// blockingMechanism returns the Block Public Access mechanism that enables
+// a setting, preferring the account-wide one
+func blockingMechanism(account bool, bucket bool) (string, bool) {
+	switch {
+	case account:
+		return MechanismAccountBlockPublicAccess, true
+	case bucket:
+		return MechanismBucketBlockPublicAccess, true
+	default:
+		return "", false
+	}
+}
+
+// applyS3BucketAccess combines each bucket's policy, ACL and Block Public
+// Access settings into a single classification, and notes which bucket
+// policies delegate access control to access points. Rows for buckets whose
+// policy grants access are updated in place, and rows are added for buckets
+// only exposed through their ACL or their access points.
+func applyS3BucketAccess(db *sql.DB, ctx *policy.Context, rows []Row, delegations map[string][]string) ([]Row, error) {
+	account, err := loadAccountBlockPublicAccess(db, ctx.Account)
+	if err != nil {
+		return nil, err
+	}
+	query, err := loadQuery("s3_bucket_access")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load s3 bucket access query")
+	}
+	bucketRows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "DB error analyzing s3 buckets")
+	}
+	defer bucketRows.Close()
+	byArn := map[string]int{}
+	for i, row := range rows {
+		if row.Service == "s3" && row.ProviderType == "Bucket" {
+			byArn[row.Arn] = i
+		}
+	}
+	for bucketRows.Next() {
+		var arn string
+		var aclJSON, blockJSON []byte
+		err = bucketRows.Scan(&arn, &aclJSON, &blockJSON)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read s3 bucket row")
+		}
+		bucket, err := parseBlockPublicAccess(blockJSON)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse Block Public Access settings for %v", arn)
+		}
+		acl := &bucketACL{}
+		if len(aclJSON) > 0 {
+			err = json.Unmarshal(aclJSON, acl)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to parse ACL for %v", arn)
+			}
+		}
+		index, hasRow := byArn[arn]
+		row := &Row{Arn: arn, Service: "s3", ProviderType: "Bucket", PublicAccess: policy.NotPublic}
+		if hasRow {
+			row = &rows[index]
+			row.AccessControls = append(row.AccessControls, AccessControl{
+				Mechanism:   MechanismBucketPolicy,
+				Description: "grants " + row.Access() + " access",
+			})
+		}
+		accounts, isDelegated := delegations[arn]
+		if isDelegated {
+			row.AccessControls = append(row.AccessControls, AccessControl{
+				Mechanism:   MechanismBucketPolicy,
+				Description: "delegates access control to access points of " + strings.Join(accounts, ", "),
+			})
+		}
+		if blockedBy, ok := blockingMechanism(account.RestrictPublicBuckets, bucket.RestrictPublicBuckets); ok && row.IsPublic() {
+			applyRestrictPublicBuckets(row, blockedBy)
+		}
+		ignoredBy, ignorePublicAcls := blockingMechanism(account.IgnorePublicAcls, bucket.IgnorePublicAcls)
+		applyBucketACL(row, acl, ignorePublicAcls, ignoredBy)
+		for _, settings := range []struct {
+			mechanism string
+			config    *blockPublicAccess
+		}{{MechanismAccountBlockPublicAccess, account}, {MechanismBucketBlockPublicAccess, bucket}} {
+			if enabled := settings.config.settings(); len(enabled) > 0 {
+				row.AccessControls = append(row.AccessControls, AccessControl{
+					Mechanism:   settings.mechanism,
+					Description: "enabled: " + strings.Join(enabled, ", "),
+				})
+			}
+		}
+		if !hasRow && (len(row.Grants) > 0 || hasACLControl(row) || isDelegated) {
+			rows = append(rows, *row)
+		}
+	}
+	return rows, nil
+}
+
+func hasACLControl(row *Row) bool {
+	for _, control := range row.AccessControls {
+		if control.Mechanism == MechanismACL {
+			return true
+		}
+	}
+	return false
+}
+
+// linkS3AccessPoints links the rows of access points and multi-region access
+// points to the rows of their buckets, in both directions. When only one
+// side has a row, a row is added for the other, so that access through an
+// access point can be traced to its bucket. Older imports do not include
+// access points, in which case nothing is linked.
+func linkS3AccessPoints(db *sql.DB, rows []Row) ([]Row, error) {
+	for _, table := range []string{"aws_s3control_accesspoint", "aws_s3control_multiregionaccesspoint"} {
+		exists, err := tableExists(db, table)
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			log.Warn("S3 access points were not imported, not linking them to buckets")
+			return rows, nil
+		}
+	}
+	query, err := loadQuery("s3_access_points")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load s3 access points query")
+	}
+	accessPointRows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "DB error analyzing s3 access points")
+	}
+	defer accessPointRows.Close()
+	links := []s3AccessPointLink{}
+	for accessPointRows.Next() {
+		var link s3AccessPointLink
+		err = accessPointRows.Scan(&link.accessPointArn, &link.providerType, &link.bucketArn)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read s3 access point row")
+		}
+		links = append(links, link)
+	}
+	return linkAccessPointRows(rows, links), nil
+}
+
+// s3AccessPointLink is an access point, or multi-region access point, and
+// one of its buckets
+type s3AccessPointLink struct {
+	accessPointArn string
+	providerType   string
+	bucketArn      string
+}
+
+func linkAccessPointRows(rows []Row, links []s3AccessPointLink) []Row {
+	byArn := map[string]int{}
+	for i := range rows {
+		byArn[rows[i].Arn] = i
+	}
+	rowIndex := func(arn string, providerType string) int {
+		index, ok := byArn[arn]
+		if !ok {
+			index = len(rows)
+			byArn[arn] = index
+			service := "s3control"
+			if providerType == "Bucket" {
+				service = "s3"
+			}
+			rows = append(rows, Row{Arn: arn, Service: service, ProviderType: providerType, PublicAccess: policy.NotPublic})
+		}
+		return index
+	}
+	for _, link := range links {
+		_, hasAccessPoint := byArn[link.accessPointArn]
+		_, hasBucket := byArn[link.bucketArn]
+		if !hasAccessPoint && !hasBucket {
+			continue
+		}
+		accessPoint := rowIndex(link.accessPointArn, link.providerType)
+		rows[accessPoint].LinkedResources = append(rows[accessPoint].LinkedResources, link.bucketArn)
+		bucket := rowIndex(link.bucketArn, "Bucket")
+		rows[bucket].LinkedResources = append(rows[bucket].LinkedResources, link.accessPointArn)
+	}
+	return rows
+}
@@ -0,0 +1,182 @@
+package report
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/goldfiglabs/rpcheckup/pkg/policy"
+)
+
+func parseACL(t *testing.T, document string) *bucketACL {
+	t.Helper()
+	acl := &bucketACL{}
+	err := json.Unmarshal([]byte(document), acl)
+	if err != nil {
+		t.Fatalf("Failed to parse ACL: %v", err)
+	}
+	return acl
+}
+
+func TestApplyBucketACL(t *testing.T) {
+	tests := []struct {
+		name             string
+		acl              string
+		ignorePublicAcls bool
+		publicAccess     policy.PublicAccess
+		externalAccounts []string
+		services         []string
+		accessLevels     []string
+		controls         []AccessControl
+	}{
+		{
+			name: "public read",
+			acl: `{"Owner": {"ID": "owner"}, "Grants": [
+				{"Grantee": {"Type": "CanonicalUser", "ID": "owner"}, "Permission": "FULL_CONTROL"},
+				{"Grantee": {"Type": "Group", "URI": "http://acs.amazonaws.com/groups/global/AllUsers"}, "Permission": "READ"}]}`,
+			publicAccess: policy.UnconditionallyPublic,
+			accessLevels: []string{AccessLevelList},
+			controls: []AccessControl{
+				{Mechanism: MechanismACL, Description: "grants AllUsers (READ)"},
+			},
+		},
+		{
+			name: "public read ignored",
+			acl: `{"Owner": {"ID": "owner"}, "Grants": [
+				{"Grantee": {"Type": "Group", "URI": "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"}, "Permission": "WRITE"}]}`,
+			ignorePublicAcls: true,
+			publicAccess:     policy.NotPublic,
+			controls: []AccessControl{
+				{Mechanism: MechanismACL, Description: "grants AuthenticatedUsers (WRITE), ignored"},
+				{Mechanism: MechanismAccountBlockPublicAccess, Blocks: true, Description: "IgnorePublicAcls ignores public ACL grants"},
+			},
+		},
+		{
+			name: "other canonical user",
+			acl: `{"Owner": {"ID": "owner"}, "Grants": [
+				{"Grantee": {"Type": "CanonicalUser", "ID": "vendor"}, "Permission": "FULL_CONTROL"}]}`,
+			publicAccess:     policy.NotPublic,
+			externalAccounts: []string{"canonical-user:vendor"},
+			accessLevels:     []string{AccessLevelList, AccessLevelRead, AccessLevelWrite, AccessLevelPermissionsManagement},
+			controls: []AccessControl{
+				{Mechanism: MechanismACL, Description: "grants FULL_CONTROL to canonical user vendor"},
+			},
+		},
+		{
+			name: "log delivery",
+			acl: `{"Owner": {"ID": "owner"}, "Grants": [
+				{"Grantee": {"Type": "Group", "URI": "http://acs.amazonaws.com/groups/s3/LogDelivery"}, "Permission": "WRITE"}]}`,
+			publicAccess: policy.NotPublic,
+			services:     []string{"logging.s3.amazonaws.com"},
+			accessLevels: []string{AccessLevelWrite},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			row := &Row{PublicAccess: policy.NotPublic}
+			applyBucketACL(row, parseACL(t, test.acl), test.ignorePublicAcls, MechanismAccountBlockPublicAccess)
+			if row.PublicAccess != test.publicAccess {
+				t.Errorf("Unexpected public access %v, want %v", row.PublicAccess, test.publicAccess)
+			}
+			if !equalStrings(row.ExternalAccounts, test.externalAccounts) {
+				t.Errorf("Unexpected external accounts %v, want %v", row.ExternalAccounts, test.externalAccounts)
+			}
+			if !equalStrings(row.Services, test.services) {
+				t.Errorf("Unexpected services %v, want %v", row.Services, test.services)
+			}
+			if !equalStrings(row.AccessLevels, test.accessLevels) {
+				t.Errorf("Unexpected access levels %v, want %v", row.AccessLevels, test.accessLevels)
+			}
+			if len(row.AccessControls) != 0 || len(test.controls) != 0 {
+				if !reflect.DeepEqual(row.AccessControls, test.controls) {
+					t.Errorf("Unexpected access controls %+v, want %+v", row.AccessControls, test.controls)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRestrictPublicBuckets(t *testing.T) {
+	row := &Row{
+		PublicAccess:     policy.UnconditionallyPublic,
+		ExternalAccounts: []string{"333333333333"},
+		AccessLevels:     []string{AccessLevelRead, AccessLevelWrite, AccessLevelPermissionsManagement},
+		Grants: []Grant{
+			{Principal: policy.Wildcard, Actions: []string{"s3:PutBucketAcl"}, AccessLevels: []string{AccessLevelPermissionsManagement}},
+			{Principal: "333333333333", Actions: []string{"s3:PutObject"}, AccessLevels: []string{AccessLevelWrite}},
+			{Principal: "cloudtrail.amazonaws.com", Actions: []string{"s3:GetBucketAcl"}, AccessLevels: []string{AccessLevelRead}},
+			{Principal: "config.amazonaws.com", Actions: []string{"s3:PutObject"}, AccessLevels: []string{AccessLevelWrite},
+				Window: policy.TimeExpired},
+		},
+	}
+	applyRestrictPublicBuckets(row, MechanismBucketBlockPublicAccess)
+	if row.PublicAccess != policy.NotPublic || len(row.ExternalAccounts) != 0 {
+		t.Errorf("Expected the public and external access to be removed, got %v %v", row.PublicAccess, row.ExternalAccounts)
+	}
+	principals := []string{}
+	for _, grant := range row.Grants {
+		principals = append(principals, grant.Principal)
+	}
+	if !equalStrings(principals, []string{"cloudtrail.amazonaws.com", "config.amazonaws.com"}) {
+		t.Errorf("Unexpected remaining grants %v", principals)
+	}
+	if !equalStrings(row.AccessLevels, []string{AccessLevelRead}) {
+		t.Errorf("Unexpected access levels %v, want only those of grants in effect", row.AccessLevels)
+	}
+}
+
+func TestLinkAccessPointRows(t *testing.T) {
+	accessPoint := "arn:aws:s3:us-east-1:111111111111:accesspoint/reports"
+	bucket := "arn:aws:s3:::reports"
+	tests := []struct {
+		name  string
+		rows  []Row
+		links []s3AccessPointLink
+		// expected maps the ARN of each row to its linked resources
+		expected map[string][]string
+	}{
+		{
+			name:  "access point only",
+			rows:  []Row{{Arn: accessPoint, Service: "s3control", ProviderType: "AccessPoint"}},
+			links: []s3AccessPointLink{{accessPoint, "AccessPoint", bucket}},
+			expected: map[string][]string{
+				accessPoint: {bucket},
+				bucket:      {accessPoint},
+			},
+		},
+		{
+			name:  "bucket only",
+			rows:  []Row{{Arn: bucket, Service: "s3", ProviderType: "Bucket"}},
+			links: []s3AccessPointLink{{accessPoint, "AccessPoint", bucket}},
+			expected: map[string][]string{
+				accessPoint: {bucket},
+				bucket:      {accessPoint},
+			},
+		},
+		{
+			name:     "neither",
+			links:    []s3AccessPointLink{{accessPoint, "AccessPoint", bucket}},
+			expected: map[string][]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows := linkAccessPointRows(test.rows, test.links)
+			linked := map[string][]string{}
+			for _, row := range rows {
+				linked[row.Arn] = row.LinkedResources
+			}
+			if !reflect.DeepEqual(linked, test.expected) {
+				t.Errorf("Unexpected links %v, want %v", linked, test.expected)
+			}
+		})
+	}
+}
+
+// equalStrings treats nil and empty lists as equal
+func equalStrings(a []string, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
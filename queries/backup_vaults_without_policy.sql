@@ -0,0 +1,13 @@
+SELECT
+	R.uri
+FROM
+	resource AS R
+WHERE
+	R.service = 'backup'
+	AND R.provider_type = 'BackupVault'
+	AND NOT EXISTS (
+		SELECT 1 FROM resource_attribute AS RA
+		WHERE RA.resource_id = R.id
+			AND RA.type = 'Metadata'
+			AND RA.attr_name = 'Policy'
+	)
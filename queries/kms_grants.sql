@@ -0,0 +1,8 @@
+SELECT
+	K.uri,
+	to_jsonb(K) -> 'grants' AS grants
+FROM
+	aws_kms_key AS K
+WHERE
+	jsonb_typeof(to_jsonb(K) -> 'grants') = 'array'
+	AND jsonb_array_length(to_jsonb(K) -> 'grants') > 0
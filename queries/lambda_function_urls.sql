@@ -0,0 +1,7 @@
+SELECT
+	F.uri,
+	to_jsonb(F) -> 'functionurlconfig' AS url_config
+FROM
+	aws_lambda_function AS F
+WHERE
+	jsonb_typeof(to_jsonb(F) -> 'functionurlconfig') = 'object'
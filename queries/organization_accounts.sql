@@ -0,0 +1,4 @@
+SELECT
+	A.id
+FROM
+	aws_organizations_account AS A
@@ -1,7 +1,8 @@
 WITH image_access AS (
 SELECT
   I.uri,
-  snapshot_account_id(LP.value) AS account_id
+  snapshot_account_id(LP.value) AS account_id,
+  snapshot_organizational_unit(LP.value) AS organizational_unit
 FROM
   aws_ec2_image AS I
   cross join lateral jsonb_array_elements(I.launchpermissions) AS LP
@@ -16,7 +17,10 @@ SELECT
 	ARRAY_AGG(IA.account_id) FILTER (WHERE NOT EXISTS (
 		SELECT 1 FROM aws_organizations_account AS A
 		WHERE A.id = IA.account_id AND $1 != A.id
-	)) AS external
+	)) AS external,
+	ARRAY_AGG(IA.organizational_unit) FILTER (
+		WHERE IA.organizational_unit IS NOT NULL
+	) AS organizational_units
 FROM
 	image_access AS IA
 GROUP BY IA.uri
\ No newline at end of file
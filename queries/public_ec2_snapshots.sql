@@ -1,7 +1,8 @@
 WITH snapshot_access AS (
 SELECT
   S.uri,
-  snapshot_account_id(CVP.value) AS account_id
+  snapshot_account_id(CVP.value) AS account_id,
+  snapshot_organizational_unit(CVP.value) AS organizational_unit
 FROM
   aws_ec2_snapshot AS S
   cross join lateral jsonb_array_elements(S.createvolumepermissions) AS CVP
@@ -16,7 +17,10 @@ SELECT
 	ARRAY_AGG(SA.account_id) FILTER (WHERE NOT EXISTS (
 		SELECT 1 FROM aws_organizations_account AS A
 		WHERE A.id = SA.account_id AND $1 != A.id
-	)) AS external
+	)) AS external,
+	ARRAY_AGG(SA.organizational_unit) FILTER (
+		WHERE SA.organizational_unit IS NOT NULL
+	) AS organizational_units
 FROM
 	snapshot_access AS SA
 GROUP BY SA.uri
\ No newline at end of file
@@ -5,6 +5,9 @@ SELECT
 FROM
   aws_rds_dbclustersnapshot AS S
   cross join lateral jsonb_array_elements(S.restore) AS CVP
+WHERE
+  -- DocumentDB and Neptune share the RDS API, $2 picks the service
+  (CASE WHEN S.engine IN ('docdb', 'neptune') THEN S.engine ELSE 'rds' END) = $2
 )
 SELECT
 	SA.uri,
@@ -16,7 +19,8 @@ SELECT
 	ARRAY_AGG(SA.account_id) FILTER (WHERE NOT EXISTS (
 		SELECT 1 FROM aws_organizations_account AS A
 		WHERE A.id = SA.account_id AND $1 != A.id
-	)) AS external
+	)) AS external,
+	NULL::TEXT[] AS organizational_units
 FROM
 	snapshot_access AS SA
 GROUP BY SA.uri
\ No newline at end of file
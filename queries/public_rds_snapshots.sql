@@ -16,7 +16,8 @@ SELECT
 	ARRAY_AGG(SA.account_id) FILTER (WHERE NOT EXISTS (
 		SELECT 1 FROM aws_organizations_account AS A
 		WHERE A.id = SA.account_id AND $1 != A.id
-	)) AS external
+	)) AS external,
+	NULL::TEXT[] AS organizational_units
 FROM
 	snapshot_access AS SA
 GROUP BY SA.uri
\ No newline at end of file
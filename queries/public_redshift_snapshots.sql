@@ -0,0 +1,23 @@
+WITH snapshot_access AS (
+SELECT
+  S.uri,
+  RA.value ->> 'AccountId' AS account_id
+FROM
+  aws_redshift_snapshot AS S
+  cross join lateral jsonb_array_elements(S.accountswithrestoreaccess) AS RA
+)
+SELECT
+	SA.uri,
+	bool_or(SA.account_id = '*') AS is_public,
+	ARRAY_AGG(SA.account_id) FILTER (WHERE EXISTS (
+		SELECT 1 FROM aws_organizations_account AS A
+		WHERE A.id = SA.account_id AND $1 != A.id
+	)) AS inorg,
+	ARRAY_AGG(SA.account_id) FILTER (WHERE NOT EXISTS (
+		SELECT 1 FROM aws_organizations_account AS A
+		WHERE A.id = SA.account_id AND $1 != A.id
+	)) AS external,
+	NULL::TEXT[] AS organizational_units
+FROM
+	snapshot_access AS SA
+GROUP BY SA.uri
\ No newline at end of file
@@ -0,0 +1,24 @@
+-- Principals and resources may be given either as plain identifiers or as
+-- association objects
+SELECT
+	S.uri,
+	COALESCE((to_jsonb(S) ->> 'allowexternalprincipals')::BOOLEAN, false) AS allow_external,
+	ARRAY(
+		SELECT COALESCE(P.value ->> 'AssociatedEntity', P.value #>> '{}')
+		FROM jsonb_array_elements(
+			CASE WHEN jsonb_typeof(to_jsonb(S) -> 'principals') = 'array'
+				THEN to_jsonb(S) -> 'principals' ELSE '[]'::JSONB END
+		) AS P
+	) AS principals,
+	ARRAY(
+		SELECT COALESCE(R.value ->> 'AssociatedEntity', R.value ->> 'arn', R.value #>> '{}')
+		FROM jsonb_array_elements(
+			CASE WHEN jsonb_typeof(to_jsonb(S) -> 'resources') = 'array'
+				THEN to_jsonb(S) -> 'resources' ELSE '[]'::JSONB END
+		) AS R
+	) AS resources
+FROM
+	aws_ram_resourceshare AS S
+WHERE
+	to_jsonb(S) ->> 'status' IS NULL
+	OR to_jsonb(S) ->> 'status' = 'ACTIVE'
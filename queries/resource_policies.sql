@@ -0,0 +1,13 @@
+SELECT
+	R.uri,
+	R.service,
+	R.provider_type,
+	jsonb_agg(RA.attr_value) AS policies
+FROM
+	resource AS R
+	INNER JOIN resource_attribute AS RA
+		ON RA.resource_id = R.id
+WHERE
+	RA.type = 'Metadata'
+	AND RA.attr_name = 'Policy'
+GROUP BY R.id, R.uri, R.service, R.provider_type
@@ -0,0 +1,15 @@
+-- Buckets behind each access point and multi-region access point
+SELECT
+	AP.uri,
+	'AccessPoint' AS provider_type,
+	'arn:aws:s3:::' || (to_jsonb(AP) ->> 'bucket') AS bucket_arn
+FROM
+	aws_s3control_accesspoint AS AP
+UNION ALL
+SELECT
+	MRAP.uri,
+	'MultiRegionAccessPoint' AS provider_type,
+	'arn:aws:s3:::' || (R.value ->> 'Bucket') AS bucket_arn
+FROM
+	aws_s3control_multiregionaccesspoint AS MRAP
+	cross join lateral jsonb_array_elements(to_jsonb(MRAP) -> 'regions') AS R
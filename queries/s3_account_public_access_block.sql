@@ -0,0 +1,6 @@
+SELECT
+	to_jsonb(P) -> 'publicaccessblockconfiguration' AS public_access_block
+FROM
+	aws_s3control_accountpublicaccessblock AS P
+WHERE
+	P.accountid = $1
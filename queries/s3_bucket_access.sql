@@ -0,0 +1,6 @@
+SELECT
+	B.uri,
+	to_jsonb(B) -> 'acl' AS acl,
+	to_jsonb(B) -> 'publicaccessblockconfiguration' AS public_access_block
+FROM
+	aws_s3_bucket AS B